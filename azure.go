@@ -11,6 +11,7 @@ import (
 	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-12-01/network"
 	"github.com/Azure/azure-sdk-for-go/services/preview/blockchain/mgmt/2018-06-01-preview/blockchain"
 	"github.com/Azure/azure-sdk-for-go/services/resources/mgmt/2019-05-01/resources"
+	"github.com/Azure/azure-sdk-for-go/services/storage/mgmt/2019-06-01/storage"
 	"github.com/Azure/go-autorest/autorest"
 	"github.com/Azure/go-autorest/autorest/azure"
 	"github.com/Azure/go-autorest/autorest/azure/auth"
@@ -19,6 +20,8 @@ import (
 	provide "github.com/provideplatform/provide-go/api/c2"
 )
 
+const containerGroupCleanupTimeout = time.Second * 60
+
 // NewAzureBlockchainMemberClient is creating an azure blockchain member client
 func NewAzureBlockchainMemberClient(tc *provide.TargetCredentials) (blockchain.MembersClient, error) {
 	client := blockchain.NewMembersClient(*tc.AzureSubscriptionID)
@@ -52,6 +55,29 @@ func NewContainerClient(tc *provide.TargetCredentials) (containerinstance.Contai
 	}
 }
 
+// NewContainerInstanceClient initializes and returns an instance of the Azure container instance API client,
+// which provides region capabilities
+func NewContainerInstanceClient(tc *provide.TargetCredentials) (containerinstance.BaseClient, error) {
+	client := containerinstance.New(*tc.AzureSubscriptionID)
+	if auth, err := GetAuthorizer(tc); err == nil {
+		client.Authorizer = *auth
+		return client, nil
+	} else {
+		return client, err
+	}
+}
+
+// NewContainerGroupUsageClient initializes and returns an instance of the Azure container group usage API client
+func NewContainerGroupUsageClient(tc *provide.TargetCredentials) (containerinstance.ContainerGroupUsageClient, error) {
+	client := containerinstance.NewContainerGroupUsageClient(*tc.AzureSubscriptionID)
+	if auth, err := GetAuthorizer(tc); err == nil {
+		client.Authorizer = *auth
+		return client, nil
+	} else {
+		return client, err
+	}
+}
+
 // NewKeyVaultClient is creating a key vault client
 func NewKeyVaultClient(tc *provide.TargetCredentials) (keyvault.BaseClient, error) {
 	client := keyvault.New()
@@ -134,7 +160,51 @@ func NewVirtualNetworksClient(tc *provide.TargetCredentials) (network.VirtualNet
 	}
 }
 
-// ContainerLogs returns container logs of `n` or 100 lines.
+// NewSecurityGroupsClient initializes and returns an instance of the Azure network security groups API client
+func NewSecurityGroupsClient(tc *provide.TargetCredentials) (network.SecurityGroupsClient, error) {
+	client := network.NewSecurityGroupsClient(*tc.AzureSubscriptionID)
+	if auth, err := GetAuthorizer(tc); err == nil {
+		client.Authorizer = *auth
+		return client, nil
+	} else {
+		return client, err
+	}
+}
+
+// NewSubnetsClient initializes and returns an instance of the Azure subnets API client
+func NewSubnetsClient(tc *provide.TargetCredentials) (network.SubnetsClient, error) {
+	client := network.NewSubnetsClient(*tc.AzureSubscriptionID)
+	if auth, err := GetAuthorizer(tc); err == nil {
+		client.Authorizer = *auth
+		return client, nil
+	} else {
+		return client, err
+	}
+}
+
+// NewInterfacesClient initializes and returns an instance of the Azure network interfaces API client
+func NewInterfacesClient(tc *provide.TargetCredentials) (network.InterfacesClient, error) {
+	client := network.NewInterfacesClient(*tc.AzureSubscriptionID)
+	if auth, err := GetAuthorizer(tc); err == nil {
+		client.Authorizer = *auth
+		return client, nil
+	} else {
+		return client, err
+	}
+}
+
+// NewFileSharesClient initializes and returns an instance of the Azure storage file shares API client
+func NewFileSharesClient(tc *provide.TargetCredentials) (storage.FileSharesClient, error) {
+	client := storage.NewFileSharesClient(*tc.AzureSubscriptionID)
+	if auth, err := GetAuthorizer(tc); err == nil {
+		client.Authorizer = *auth
+		return client, nil
+	} else {
+		return client, err
+	}
+}
+
+// ContainerLogs returns container logs of `n` or 100 lines; the logs of init containers are retrieved by name.
 func ContainerLogs(ctx context.Context, tc *provide.TargetCredentials, resourceGroupName, containerGroupName, containerID string, n *int32) (logs containerinstance.Logs, err error) {
 	var number int32
 	if n == nil {
@@ -147,7 +217,7 @@ func ContainerLogs(ctx context.Context, tc *provide.TargetCredentials, resourceG
 		return logs, fmt.Errorf("Unable to get container client: %s; ", err.Error())
 	}
 
-	logs, err = cClient.ListLogs(ctx, resourceGroupName, containerGroupName, containerID, to.Int32Ptr(number))
+	logs, err = listContainerLogs(ctx, cClient, resourceGroupName, containerGroupName, containerID, to.Int32Ptr(number))
 	if err != nil {
 		return logs, fmt.Errorf("Unable to get container logs: %s; ", err.Error())
 	}
@@ -155,19 +225,12 @@ func ContainerLogs(ctx context.Context, tc *provide.TargetCredentials, resourceG
 	return logs, nil
 }
 
-// DeleteContainer deletes container by its ID
+// DeleteContainer deletes container by its ID and waits until it no longer exists; a container which does not exist is considered deleted
 func DeleteContainer(ctx context.Context, tc *provide.TargetCredentials, resourceGroupName string, containerID string) (err error) {
-	cgClient, err := NewContainerGroupsClient(tc)
-	if err != nil {
-		return fmt.Errorf("Unable to get container group client: %s; ", err.Error())
-	}
-
-	_, err = cgClient.Delete(ctx, resourceGroupName, containerID)
-	if err != nil {
-		return fmt.Errorf("Unable to delete container: %s; ", err.Error())
-	}
-
-	return nil
+	_, err = DeleteContainerWithOptions(ctx, tc, resourceGroupName, containerID, &ContainerDeleteOptions{
+		IgnoreNotFound: true,
+	})
+	return err
 }
 
 // AzureContainerCreateParams is a struct representing the params needed to start an Azure container.
@@ -194,24 +257,236 @@ type AzureContainerCreateResult struct {
 	err          error
 }
 
+// ContainerOptions is a struct representing Azure-specific container params which are not
+// part of the provider-neutral container params
+type ContainerOptions struct {
+	LivenessProbe  *ContainerProbeParams
+	ReadinessProbe *ContainerProbeParams
+	RestartPolicy  containerinstance.ContainerGroupRestartPolicy
+	Resources      *ContainerResources
+
+	DNSNameLabel            *string
+	DNSNameLabelReusePolicy DNSNameLabelReusePolicy
+
+	OsType       containerinstance.OperatingSystemTypes
+	Volumes      []containerinstance.Volume
+	VolumeMounts []containerinstance.VolumeMount
+
+	// InitContainers run to completion, in order, before the main container is started
+	InitContainers []InitContainerParams
+
+	Tags map[string]string
+
+	// SecurityPolicy takes precedence over the security config of the container params when given
+	SecurityPolicy *SecurityPolicy
+
+	// SubnetID is the ARM resource ID of the subnet into which the container group is deployed using a private IP
+	// address; the security policy is enforced on the subnet. The container group is exposed using a public IP
+	// address when it is not given
+	SubnetID string
+
+	// Regions is a ranked list of acceptable regions which takes precedence over the region of the container params;
+	// the deployment fails over to the next region when a region lacks quota, capability or capacity, or the container
+	// group created in a region fails to deploy. An existing container group is only updated in its own region.
+	// Subnets are bound to the region of their virtual network, so only one region is accepted with a subnet ID
+	Regions []string
+
+	// Preflight validates the container group against the capabilities and quota of the region before it is submitted
+	Preflight bool
+
+	// CleanupOnCancel deletes the partially-created container group when the context is cancelled or expires
+	CleanupOnCancel bool
+}
+
+// ContainerStartCancelledError is returned when the context is cancelled or expires before the
+// container group deployment completes; it reports the resources which were left behind
+type ContainerStartCancelledError struct {
+	ResourceGroupName  string
+	ContainerGroupName string
+	CleanedUp          bool
+	LeftBehind         []string
+	Err                error
+}
+
+func (e *ContainerStartCancelledError) Error() string {
+	if e.CleanedUp {
+		return fmt.Sprintf("container group %s deployment cancelled and cleaned up; %s", e.ContainerGroupName, e.Err.Error())
+	}
+	return fmt.Sprintf("container group %s deployment cancelled; left behind: %v; %s", e.ContainerGroupName, e.LeftBehind, e.Err.Error())
+}
+
+// Unwrap returns the context error which caused the cancellation
+func (e *ContainerStartCancelledError) Unwrap() error {
+	return e.Err
+}
+
 // StartContainer starts a new node in network
-func StartContainer(cp *provide.ContainerParams, tc *provide.TargetCredentials) (result *provide.ContainerCreateResult, err error) {
+func StartContainer(ctx context.Context, cp *provide.ContainerParams, tc *provide.TargetCredentials) (result *provide.ContainerCreateResult, err error) {
+	return StartContainerWithOptions(ctx, cp, tc, nil)
+}
+
+// StartContainerWithOptions starts a new node in network using the given Azure-specific options; when regions
+// are given in the options, the node is placed in the first region with enough quota and capability
+func StartContainerWithOptions(ctx context.Context, cp *provide.ContainerParams, tc *provide.TargetCredentials, opts *ContainerOptions) (result *provide.ContainerCreateResult, err error) {
+	result, _, err = startContainerWithOptions(ctx, cp, tc, opts)
+	return result, err
+}
+
+// StartContainerWithPlacement starts a new node in network using the given Azure-specific options and returns the
+// region in which it was placed, which is the region of the container params unless regions are given in the options
+func StartContainerWithPlacement(ctx context.Context, cp *provide.ContainerParams, tc *provide.TargetCredentials, opts *ContainerOptions) (*ContainerPlacementResult, error) {
+	if opts != nil && len(opts.Regions) > 0 {
+		result, region, _, err := startContainerWithFailover(ctx, cp, tc, opts)
+		if err != nil {
+			return nil, err
+		}
+		return &ContainerPlacementResult{Region: region, Result: result}, nil
+	}
+
+	result, _, err := startContainer(ctx, cp, tc, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &ContainerPlacementResult{Region: cp.Region, Result: result}, nil
+}
+
+// startContainerWithOptions starts a new node in network using the given Azure-specific options; it reports
+// whether a container group deployment was submitted, in which case the container group may exist even on error
+func startContainerWithOptions(ctx context.Context, cp *provide.ContainerParams, tc *provide.TargetCredentials, opts *ContainerOptions) (result *provide.ContainerCreateResult, submitted bool, err error) {
+	if opts != nil && len(opts.Regions) > 0 {
+		result, _, submitted, err = startContainerWithFailover(ctx, cp, tc, opts)
+		return result, submitted, err
+	}
+	return startContainer(ctx, cp, tc, opts)
+}
+
+// startContainer starts a new node in network in the region given in the container params
+func startContainer(ctx context.Context, cp *provide.ContainerParams, tc *provide.TargetCredentials, opts *ContainerOptions) (result *provide.ContainerCreateResult, submitted bool, err error) {
+	loadContainerRegionResourceLimits(ctx, tc, cp)
+	containerGroupParams, err := containerGroupFromParams(cp, tc, opts)
+	if err != nil {
+		return nil, false, err
+	}
+
+	err = preflightContainerGroupIfRequested(ctx, tc, cp, *containerGroupParams, opts)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return deployContainerGroup(ctx, cp, tc, opts, *containerGroupParams)
+}
+
+// deployContainerGroup creates or updates the given container group and waits for the deployment to complete;
+// submitted is true once the create or update request was accepted by Azure
+func deployContainerGroup(ctx context.Context, cp *provide.ContainerParams, tc *provide.TargetCredentials, opts *ContainerOptions, containerGroupParams containerinstance.ContainerGroup) (result *provide.ContainerCreateResult, submitted bool, err error) {
+	// containerGroupName, _ := uuid.NewV4()
+	// containerName := cp.Image //uuid.NewV4()
+	cgClient, err := NewContainerGroupsClient(tc)
+	if err != nil {
+		log.Warningf("Unable to get container group client: %s; ", err.Error())
+		return nil, false, err
+	}
+
+	err = prepareContainerGroupSubnet(ctx, tc, cp, opts)
+	if err != nil {
+		log.Warningf("failed to prepare subnet for container group; %s", err.Error())
+		return nil, false, err
+	}
+
+	future, err := createOrUpdateContainerGroup(ctx, cgClient, cp.ResourceGroupName, *cp.ContainerGroupName, containerGroupParams, opts)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, false, cancelledContainerStart(tc, cp, opts, ctx.Err())
+		}
+		log.Warningf("failed to create container group; %s", err.Error())
+		return nil, false, err
+	}
+
+	err = future.WaitForCompletionRef(ctx, cgClient.Client)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, true, cancelledContainerStart(tc, cp, opts, ctx.Err())
+		}
+		log.Warningf("failed to create container group; %s", err.Error())
+		return nil, true, err
+	}
+
+	containerGroup, err := future.Result(cgClient)
+	if err != nil {
+		log.Warningf("failed to create container group; %s", err.Error())
+		return nil, true, err
+	}
+
+	return containerCreateResult(containerGroup), true, nil
+	// return []string{*containerGroup.ID}, []string{*containerGroup.Name}, nil
+}
+
+// cancelledContainerStart optionally cleans up the container group of a cancelled deployment and
+// returns an error describing what was left behind
+func cancelledContainerStart(tc *provide.TargetCredentials, cp *provide.ContainerParams, opts *ContainerOptions, cause error) error {
+	cancelErr := &ContainerStartCancelledError{
+		ResourceGroupName:  cp.ResourceGroupName,
+		ContainerGroupName: *cp.ContainerGroupName,
+		LeftBehind:         []string{},
+		Err:                cause,
+	}
+
+	if opts != nil && opts.CleanupOnCancel {
+		err := cleanupContainerGroup(tc, cp.ResourceGroupName, *cp.ContainerGroupName)
+		if err == nil {
+			cancelErr.CleanedUp = true
+			log.Debugf("cleaned up container group %s after cancelled deployment", *cp.ContainerGroupName)
+			return cancelErr
+		}
+		log.Warningf("failed to clean up container group %s after cancelled deployment; %s", *cp.ContainerGroupName, err.Error())
+	}
+
+	cancelErr.LeftBehind = append(cancelErr.LeftBehind, containerGroupResourceID(tc, cp.ResourceGroupName, *cp.ContainerGroupName))
+	return cancelErr
+}
+
+// containerGroupResourceID returns the ARM resource ID of the given container group
+func containerGroupResourceID(tc *provide.TargetCredentials, resourceGroupName, containerGroupName string) string {
+	return fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.ContainerInstance/containerGroups/%s", *tc.AzureSubscriptionID, resourceGroupName, containerGroupName)
+}
+
+// cleanupContainerGroup deletes the container group using a fresh context, since the caller context may have expired
+func cleanupContainerGroup(tc *provide.TargetCredentials, resourceGroupName, containerGroupName string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), containerGroupCleanupTimeout)
+	defer cancel()
+
+	return DeleteContainer(ctx, tc, resourceGroupName, containerGroupName)
+}
+
+// containerCreateResult maps the given container group into a provider-neutral container create result
+func containerCreateResult(containerGroup containerinstance.ContainerGroup) *provide.ContainerCreateResult {
+	// containerProperties := *(containerGroup.Containers)
+	interfaces := make([]*provide.NetworkInterface, 1)
+	interfaces[0] = containerGroupNetworkInterface(containerGroup)
+
+	return &provide.ContainerCreateResult{ContainerIds: []string{*containerGroup.Name}, ContainerInterfaces: interfaces}
+}
+
+// containerGroupFromParams builds the container group definition for the given container params and options
+func containerGroupFromParams(cp *provide.ContainerParams, tc *provide.TargetCredentials, opts *ContainerOptions) (*containerinstance.ContainerGroup, error) {
 	if cp.Image == nil {
 		return nil, fmt.Errorf("Unable to start container in region: %s; container can only be started with a valid image or task definition", cp.Region)
 	}
 
-	security := cp.Security
-	if security != nil && len(security) == 0 {
+	if cp.ContainerGroupName == nil {
+		return nil, fmt.Errorf("Unable to start container in region: %s; container group name is required", cp.Region)
+	}
+
+	if cp.Security != nil && len(cp.Security) == 0 {
 		return nil, fmt.Errorf("Unable to start container w/o security config")
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 1000*time.Second)
-	defer cancel()
 	region := cp.Region
-	resourceGroupName := cp.ResourceGroupName
+	containerName := cp.ContainerName
+	if containerName == nil {
+		containerName = cp.ContainerGroupName
+	}
 	// virtualNetworkID *string,
-	cpu := cp.CPU
-	memory := cp.Memory
 
 	environment := cp.Environment
 
@@ -225,121 +500,177 @@ func StartContainer(cp *provide.ContainerParams, tc *provide.TargetCredentials)
 		}
 	}
 
-	// var healthCheck *ecs.HealthCheck
-	portMappings := make([]containerinstance.Port, 0)
-	containerPortMappings := make([]containerinstance.ContainerPort, 0)
+	policy, err := containerSecurityPolicy(cp, opts)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to start container in region: %s; %s", cp.Region, err.Error())
+	}
 
-	if security != nil {
-		if ingress, ingressOk := security["ingress"]; ingressOk {
-			switch ingress.(type) {
-			case map[string]interface{}:
-				ingressCfg := ingress.(map[string]interface{})
-				for cidr := range ingressCfg {
-					if tcp, tcpOk := ingressCfg[cidr].(map[string]interface{})["tcp"].([]interface{}); tcpOk {
-						for i := range tcp {
-							port := int32(tcp[i].(float64))
-							portMappings = append(portMappings, containerinstance.Port{
-								Port:     &port,
-								Protocol: containerinstance.TCP,
-							})
-							containerPortMappings = append(containerPortMappings, containerinstance.ContainerPort{
-								Port: &port,
-							})
-						}
-					}
-
-					if udp, udpOk := ingressCfg[cidr].(map[string]interface{})["udp"].([]interface{}); udpOk {
-						for i := range udp {
-							port := int32(udp[i].(float64))
-							portMappings = append(portMappings, containerinstance.Port{
-								Port:     &port,
-								Protocol: containerinstance.UDP,
-							})
-							containerPortMappings = append(containerPortMappings, containerinstance.ContainerPort{
-								Port: &port,
-							})
-						}
-					}
-				}
+	subnetID, err := containerGroupSubnetID(opts)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to start container in region: %s; %s", cp.Region, err.Error())
+	}
+
+	// the public IP address of a container group exposes its ports to any source and has no network security group
+	// to restrict egress; restrictions are enforced on the subnet when the container group is deployed into one
+	if subnetID == "" {
+		if cidrs := policy.RestrictedIngressCIDRs(); len(cidrs) > 0 {
+			return nil, &IngressSourceRestrictionError{
+				Target: "container group public IP address",
+				CIDRs:  cidrs,
 			}
 		}
+
+		if !policy.EgressUnrestricted {
+			return nil, &EgressRestrictionError{Target: "container group public IP address"}
+		}
 	}
 
-	// containerGroupName, _ := uuid.NewV4()
-	// containerName := cp.Image //uuid.NewV4()
-	cgClient, err := NewContainerGroupsClient(tc)
-	if err != nil {
-		log.Warningf("Unable to get container group client: %s; ", err.Error())
-		return nil, err
+	var ingressPorts []securityPort
+	if subnetID == "" {
+		ingressPorts, err = policy.ingressPorts()
+		if err != nil {
+			return nil, fmt.Errorf("Unable to start container in region: %s; %s", cp.Region, err.Error())
+		}
+	} else {
+		ingressPorts = policy.subnetIngressPorts()
 	}
 
-	future, err := cgClient.CreateOrUpdate(
-		ctx,
-		resourceGroupName,
-		*cp.ContainerGroupName,
-		containerinstance.ContainerGroup{
-			Name:     cp.ContainerGroupName,
-			Location: &region,
-			ContainerGroupProperties: &containerinstance.ContainerGroupProperties{
-				IPAddress: &containerinstance.IPAddress{
-					Type:  containerinstance.Public,
-					Ports: &portMappings,
-				},
-				OsType: containerinstance.Linux,
-				Containers: &[]containerinstance.Container{
-					{
-						Name: cp.ContainerName,
-						ContainerProperties: &containerinstance.ContainerProperties{
-							EnvironmentVariables: &env,
-							Image:                cp.Image,
-							Ports:                &containerPortMappings,
-							Resources: &containerinstance.ResourceRequirements{
-								Limits: &containerinstance.ResourceLimits{
-									MemoryInGB: to.Float64Ptr(float64(*memory)),
-									CPU:        to.Float64Ptr(float64(*cpu)),
-								},
-								Requests: &containerinstance.ResourceRequests{
-									MemoryInGB: to.Float64Ptr(float64(*memory)),
-									CPU:        to.Float64Ptr(float64(*cpu)),
-								},
-							},
-						},
-					},
-				},
-			},
-		},
-	)
+	portMappings := make([]containerinstance.Port, 0)
+	containerPortMappings := make([]containerinstance.ContainerPort, 0)
+	for _, ingressPort := range ingressPorts {
+		port := ingressPort.Port
+		protocol := containerinstance.TCP
+		if ingressPort.Protocol == SecurityProtocolUDP {
+			protocol = containerinstance.UDP
+		}
+		portMappings = append(portMappings, containerinstance.Port{
+			Port:     &port,
+			Protocol: protocol,
+		})
+		containerPortMappings = append(containerPortMappings, containerinstance.ContainerPort{
+			Port: &port,
+		})
+	}
 
+	osType, err := containerOSType(opts)
 	if err != nil {
-		log.Warningf("failed to create container group; %s", err.Error())
-		return nil, err
+		return nil, fmt.Errorf("Unable to start container in region: %s; %s", cp.Region, err.Error())
 	}
 
-	err = future.WaitForCompletionRef(ctx, cgClient.Client)
+	err = validateContainerOSFeatures(osType, opts)
 	if err != nil {
-		log.Warningf("failed to create container group; %s", err.Error())
-		return nil, err
+		return nil, fmt.Errorf("Unable to start container in region: %s; %s", cp.Region, err.Error())
 	}
 
-	containerGroup, err := future.Result(cgClient)
+	if opts != nil {
+		err = validateInitContainers(osType, *containerName, opts.InitContainers)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to start container in region: %s; %s", cp.Region, err.Error())
+		}
+	}
+
+	var resourceParams *ContainerResources
+	if opts != nil {
+		resourceParams = opts.Resources
+	}
+	resourceRequirements, err := containerResourceRequirements(cp, resourceParams)
+	if limitErr, ok := err.(*ContainerResourceLimitError); ok {
+		return nil, limitErr
+	}
 	if err != nil {
-		log.Warningf("failed to create container group; %s", err.Error())
-		return nil, err
+		return nil, fmt.Errorf("Unable to start container in region: %s; %s", cp.Region, err.Error())
 	}
 
-	// containerProperties := *(containerGroup.Containers)
-	interfaces := make([]*provide.NetworkInterface, 1)
-	intf := provide.NetworkInterface{
-		Host:        containerGroup.ContainerGroupProperties.IPAddress.Fqdn,
-		IPv4:        containerGroup.ContainerGroupProperties.IPAddress.IP,
-		IPv6:        nil,
-		PrivateIPv4: nil,
-		PrivateIPv6: nil,
+	ipAddress := &containerinstance.IPAddress{
+		Type:  containerinstance.Private,
+		Ports: &portMappings,
+	}
+	var networkProfile *containerinstance.ContainerGroupNetworkProfile
+	if subnetID != "" {
+		if opts != nil && opts.DNSNameLabel != nil {
+			return nil, fmt.Errorf("Unable to start container in region: %s; DNS name labels are not supported for container groups deployed into a subnet", cp.Region)
+		}
+		networkProfile = &containerinstance.ContainerGroupNetworkProfile{
+			ID: to.StringPtr(subnetNetworkProfileID(tc, subnetID)),
+		}
+	} else {
+		var dnsNameLabel *string
+		var dnsNameLabelReusePolicy DNSNameLabelReusePolicy
+		if opts != nil {
+			dnsNameLabel = opts.DNSNameLabel
+			dnsNameLabelReusePolicy = opts.DNSNameLabelReusePolicy
+		}
+		dnsNameLabel, err = containerDNSNameLabel(cp, tc, dnsNameLabel, dnsNameLabelReusePolicy)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to start container in region: %s; %s", cp.Region, err.Error())
+		}
+		ipAddress.Type = containerinstance.Public
+		ipAddress.DNSNameLabel = dnsNameLabel
 	}
-	interfaces[0] = &intf
 
-	return &provide.ContainerCreateResult{ContainerIds: []string{*containerGroup.Name}, ContainerInterfaces: interfaces}, nil
-	// return []string{*containerGroup.ID}, []string{*containerGroup.Name}, nil
+	var tagParams map[string]string
+	if opts != nil {
+		tagParams = opts.Tags
+	}
+	tags, err := resourceTags(tagParams)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to start container in region: %s; %s", cp.Region, err.Error())
+	}
+
+	var livenessProbe *containerinstance.ContainerProbe
+	var readinessProbe *containerinstance.ContainerProbe
+	if opts != nil {
+		livenessProbe, err = containerProbe(opts.LivenessProbe, portMappings)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to configure liveness probe: %s; ", err.Error())
+		}
+		readinessProbe, err = containerProbe(opts.ReadinessProbe, portMappings)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to configure readiness probe: %s; ", err.Error())
+		}
+	}
+
+	containerGroup := containerinstance.ContainerGroup{
+		Name:     cp.ContainerGroupName,
+		Location: &region,
+		Tags:     tags,
+		ContainerGroupProperties: &containerinstance.ContainerGroupProperties{
+			IPAddress:      ipAddress,
+			NetworkProfile: networkProfile,
+			OsType:         osType,
+			Containers: &[]containerinstance.Container{
+				{
+					Name: containerName,
+					ContainerProperties: &containerinstance.ContainerProperties{
+						EnvironmentVariables: &env,
+						Image:                cp.Image,
+						Ports:                &containerPortMappings,
+						LivenessProbe:        livenessProbe,
+						ReadinessProbe:       readinessProbe,
+						Resources:            resourceRequirements,
+					},
+				},
+			},
+		},
+	}
+
+	if opts != nil {
+		if opts.RestartPolicy != "" {
+			containerGroup.RestartPolicy = opts.RestartPolicy
+		}
+		if len(opts.Volumes) > 0 {
+			volumes := make([]containerinstance.Volume, len(opts.Volumes))
+			copy(volumes, opts.Volumes)
+			containerGroup.Volumes = &volumes
+		}
+		if len(opts.VolumeMounts) > 0 {
+			volumeMounts := make([]containerinstance.VolumeMount, len(opts.VolumeMounts))
+			copy(volumeMounts, opts.VolumeMounts)
+			(*containerGroup.Containers)[0].VolumeMounts = &volumeMounts
+		}
+	}
+
+	return &containerGroup, nil
 }
 
 // DeleteResourceGroup deletes resource group
@@ -364,14 +695,29 @@ func DeleteResourceGroup(ctx context.Context, tc *provide.TargetCredentials, nam
 }
 
 // UpsertResourceGroup upserts a resource group for the given params
-func UpsertResourceGroup(ctx context.Context, tc *provide.TargetCredentials, region, name string) (*string, error) {
+func UpsertResourceGroup(ctx context.Context, tc *provide.TargetCredentials, region, name string, tags map[string]string) (*string, error) {
 	gClient, err := NewResourceGroupsClient(tc)
 	if err != nil {
 		return nil, fmt.Errorf("failed to init resource groups client; %s", err.Error())
 	}
 
+	groupTags, err := resourceTags(tags)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upsert resource group; %s", err.Error())
+	}
+
+	existing, err := gClient.Get(ctx, name)
+	if err != nil && !isNotFound(err) {
+		return nil, fmt.Errorf("failed to upsert resource group; %s", err.Error())
+	}
+	groupTags, err = upsertedResourceTags(groupTags, existing.Tags, err == nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upsert resource group; %s", err.Error())
+	}
+
 	group := resources.Group{
 		Location: to.StringPtr(region),
+		Tags:     groupTags,
 	}
 
 	group, err = gClient.CreateOrUpdate(ctx, name, group)
@@ -403,36 +749,47 @@ func DeleteVirtuaNetwork(ctx context.Context, tc *provide.TargetCredentials, res
 	return res.HasHTTPStatus(200), nil
 }
 
-// UpsertVirtualNetwork upserts a resource group for the given params
-func UpsertVirtualNetwork(ctx context.Context, tc *provide.TargetCredentials, groupName, name, region string) (*network.VirtualNetwork, error) {
+// UpsertVirtualNetwork upserts a virtual network with the address space and subnets of the given spec;
+// when no range is given, non-overlapping ranges are allocated from the configured supernet and a single
+// default subnet is created if no spec is given. Existing subnets which are not in the spec are preserved
+func UpsertVirtualNetwork(ctx context.Context, tc *provide.TargetCredentials, groupName, name, region string, spec *VirtualNetworkSpec, tags map[string]string) (*network.VirtualNetwork, error) {
+	// serialize upserts so concurrent allocations are not allocated the same range
+	cidrAllocationMutex.Lock()
+	defer cidrAllocationMutex.Unlock()
+
+	existing, err := getVirtualNetwork(ctx, tc, groupName, name)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create virtual network: %v", err)
+	}
+
+	if spec.requiresAllocation() {
+		spec, err = allocateVirtualNetworkSpec(ctx, tc, existing, spec)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create virtual network: %v", err)
+		}
+	}
+	err = spec.withPreservedSubnets(existing).validate()
+	if err != nil {
+		return nil, fmt.Errorf("cannot create virtual network: %v", err)
+	}
+
+	vnetTags, err := resourceTags(tags)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create virtual network: %v", err)
+	}
+	if existing != nil {
+		vnetTags, err = upsertedResourceTags(vnetTags, existing.Tags, true)
+	} else {
+		vnetTags, err = upsertedResourceTags(vnetTags, nil, false)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot create virtual network: %v", err)
+	}
+
 	vnetClient, _ := NewVirtualNetworksClient(tc)
-	future, err := vnetClient.CreateOrUpdate(
-		ctx,
-		groupName,
-		name,
-		network.VirtualNetwork{
-			Location: to.StringPtr(region),
-			VirtualNetworkPropertiesFormat: &network.VirtualNetworkPropertiesFormat{
-				AddressSpace: &network.AddressSpace{
-					AddressPrefixes: &[]string{"10.0.0.0/8"},
-				},
-				Subnets: &[]network.Subnet{
-					{
-						Name: to.StringPtr("subnet1Name"),
-						SubnetPropertiesFormat: &network.SubnetPropertiesFormat{
-							AddressPrefix: to.StringPtr("10.0.0.0/16"),
-						},
-					},
-					{
-						Name: to.StringPtr("subnet2Name"),
-						SubnetPropertiesFormat: &network.SubnetPropertiesFormat{
-							AddressPrefix: to.StringPtr("10.1.0.0/16"),
-						},
-					},
-				},
-			},
-		},
-	)
+	vnet := virtualNetworkFromSpec(region, vnetTags, spec, existing)
+	preserveSubnets(&vnet, existing)
+	future, err := vnetClient.CreateOrUpdate(ctx, groupName, name, vnet)
 	if err != nil {
 		return nil, fmt.Errorf("cannot create virtual network: %v", err)
 	}
@@ -442,7 +799,7 @@ func UpsertVirtualNetwork(ctx context.Context, tc *provide.TargetCredentials, gr
 		return nil, fmt.Errorf("cannot get the vnet create or update future response: %v", err)
 	}
 
-	vnet, err := future.Result(vnetClient)
+	vnet, err = future.Result(vnetClient)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create new virtual network; %s", err.Error())
 	}
@@ -471,10 +828,65 @@ func DeleteLoadBalancer(ctx context.Context, lbName, groupName string, tc *provi
 	return response.HasHTTPStatus(200), err
 }
 
-// CreateLoadBalancer creates load balancer for a group
-func CreateLoadBalancer(ctx context.Context, lbName, location, pipName, groupName string, tc *provide.TargetCredentials, security map[string]interface{}) (lb *network.LoadBalancer, err error) {
+// CreateLoadBalancer creates load balancer for a group; a load balancer cannot enforce ingress source
+// restrictions, so use CreateLoadBalancerForSubnet when the security config restricts ingress CIDRs
+func CreateLoadBalancer(ctx context.Context, lbName, location, pipName, groupName string, tc *provide.TargetCredentials, security map[string]interface{}, tags map[string]string) (lb *network.LoadBalancer, err error) {
+	policy, err := loadBalancerSecurityPolicy(security)
+	if err != nil {
+		return lb, err
+	}
+
+	if cidrs := policy.RestrictedIngressCIDRs(); len(cidrs) > 0 {
+		return lb, &IngressSourceRestrictionError{
+			Target: "load balancer",
+			CIDRs:  cidrs,
+		}
+	}
+
+	return createLoadBalancer(ctx, lbName, location, pipName, groupName, tc, policy, tags)
+}
+
+// CreateLoadBalancerForSubnet enforces the security policy using a network security group on the backend subnet
+// and creates load balancer for a group
+func CreateLoadBalancerForSubnet(ctx context.Context, lbName, location, pipName, groupName, virtualNetworkName, subnetName string, tc *provide.TargetCredentials, security map[string]interface{}, tags map[string]string) (lb *network.LoadBalancer, err error) {
+	policy, err := loadBalancerSecurityPolicy(security)
+	if err != nil {
+		return lb, err
+	}
+
+	_, err = EnforceSecurityPolicy(ctx, tc, groupName, location, virtualNetworkName, subnetName, policy, tags)
+	if err != nil {
+		return lb, err
+	}
+
+	return createLoadBalancer(ctx, lbName, location, pipName, groupName, tc, policy, tags)
+}
+
+// loadBalancerSecurityPolicy parses the security config given to create a load balancer
+func loadBalancerSecurityPolicy(security map[string]interface{}) (*SecurityPolicy, error) {
 	if security != nil && len(security) == 0 {
-		return lb, fmt.Errorf("Unable to start container w/o security config")
+		return nil, fmt.Errorf("Unable to start container w/o security config")
+	}
+
+	policy, err := ParseSecurityPolicy(security)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create load balancer: %v", err)
+	}
+	if _, err := policy.ingressPorts(); err != nil {
+		return nil, fmt.Errorf("cannot create load balancer: %v", err)
+	}
+	return policy, nil
+}
+
+func createLoadBalancer(ctx context.Context, lbName, location, pipName, groupName string, tc *provide.TargetCredentials, policy *SecurityPolicy, tags map[string]string) (lb *network.LoadBalancer, err error) {
+	lbTags, err := resourceTags(tags)
+	if err != nil {
+		return lb, fmt.Errorf("cannot create load balancer: %v", err)
+	}
+
+	ingressPorts, err := policy.ingressPorts()
+	if err != nil {
+		return lb, fmt.Errorf("cannot create load balancer: %v", err)
 	}
 
 	probeName := "probe"
@@ -494,6 +906,15 @@ func CreateLoadBalancer(ctx context.Context, lbName, location, pipName, groupNam
 	}
 	println(fmt.Sprintf("client: %+v", lbClient))
 
+	existing, err := lbClient.Get(ctx, groupName, lbName, "")
+	if err != nil && !isNotFound(err) {
+		return nil, fmt.Errorf("failed to get load balancer; %s", err.Error())
+	}
+	lbTags, err = upsertedResourceTags(lbTags, existing.Tags, err == nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create load balancer: %v", err)
+	}
+
 	rules := make([]network.LoadBalancingRule, 0)
 	inboundNatRules := make([]network.InboundNatRule, 0)
 	// outboundRules := make([]network.OutboundRule, 0)
@@ -523,108 +944,44 @@ func CreateLoadBalancer(ctx context.Context, lbName, location, pipName, groupNam
 	// portMappings := make([]containerinstance.Port, 0)
 	// containerPortMappings := make([]containerinstance.ContainerPort, 0)
 
-	if security != nil {
-		if ingress, ingressOk := security["ingress"]; ingressOk {
-			switch ingress.(type) {
-			case map[string]interface{}:
-				ingressCfg := ingress.(map[string]interface{})
-				for cidr := range ingressCfg {
-					if tcp, tcpOk := ingressCfg[cidr].(map[string]interface{})["tcp"].([]interface{}); tcpOk {
-
-						for x, i := range tcp {
-							port := int32(i.(float64))
-							if x == 0 {
-								healthCheckPort = port
-							}
-
-							rule := network.LoadBalancingRule{
-								Name: to.StringPtr(fmt.Sprintf("lbRuleTcp%d", x)),
-								LoadBalancingRulePropertiesFormat: &network.LoadBalancingRulePropertiesFormat{
-									Protocol:             network.TransportProtocolTCP,
-									FrontendPort:         to.Int32Ptr(port),
-									BackendPort:          to.Int32Ptr(port),
-									IdleTimeoutInMinutes: to.Int32Ptr(4),
-									EnableFloatingIP:     to.BoolPtr(false),
-									LoadDistribution:     network.LoadDistributionDefault,
-									FrontendIPConfiguration: &network.SubResource{
-										ID: to.StringPtr(fmt.Sprintf("/%s/%s/frontendIPConfigurations/%s", idPrefix, lbName, frontEndIPConfigName)),
-									},
-									BackendAddressPool: &network.SubResource{
-										ID: to.StringPtr(fmt.Sprintf("/%s/%s/backendAddressPools/%s", idPrefix, lbName, backEndAddressPoolName)),
-									},
-									Probe: &network.SubResource{
-										ID: to.StringPtr(fmt.Sprintf("/%s/%s/probes/%s", idPrefix, lbName, probeName)),
-									},
-								},
-							}
-							rules = append(rules, rule)
-
-							// natRule := network.InboundNatRule{
-							// 	Name: to.StringPtr(fmt.Sprintf("natRuleTcp%d", x)),
-							// 	InboundNatRulePropertiesFormat: &network.InboundNatRulePropertiesFormat{
-							// 		Protocol:             network.TransportProtocolTCP,
-							// 		FrontendPort:         to.Int32Ptr(port),
-							// 		BackendPort:          to.Int32Ptr(port),
-							// 		EnableFloatingIP:     to.BoolPtr(false),
-							// 		IdleTimeoutInMinutes: to.Int32Ptr(5),
-							// 		FrontendIPConfiguration: &network.SubResource{
-							// 			ID: to.StringPtr(fmt.Sprintf("/%s/%s/frontendIPConfigurations/%s", idPrefix, lbName, frontEndIPConfigName)),
-							// 		},
-							// 	},
-							// }
-							// inboundNatRules = append(inboundNatRules, natRule)
-
-							// outboundRules = append()
-
-						}
-					}
-
-					if udp, udpOk := ingressCfg[cidr].(map[string]interface{})["udp"].([]interface{}); udpOk {
-						for i := range udp {
-							port := int32(udp[i].(float64))
-
-							rule := network.LoadBalancingRule{
-								Name: to.StringPtr(fmt.Sprintf("lbRuleUdp%d", i)),
-								LoadBalancingRulePropertiesFormat: &network.LoadBalancingRulePropertiesFormat{
-									Protocol:             network.TransportProtocolUDP,
-									FrontendPort:         to.Int32Ptr(port),
-									BackendPort:          to.Int32Ptr(port),
-									IdleTimeoutInMinutes: to.Int32Ptr(4),
-									EnableFloatingIP:     to.BoolPtr(false),
-									LoadDistribution:     network.LoadDistributionDefault,
-									FrontendIPConfiguration: &network.SubResource{
-										ID: to.StringPtr(fmt.Sprintf("/%s/%s/frontendIPConfigurations/%s", idPrefix, lbName, frontEndIPConfigName)),
-									},
-									BackendAddressPool: &network.SubResource{
-										ID: to.StringPtr(fmt.Sprintf("/%s/%s/backendAddressPools/%s", idPrefix, lbName, backEndAddressPoolName)),
-									},
-									Probe: &network.SubResource{
-										ID: to.StringPtr(fmt.Sprintf("/%s/%s/probes/%s", idPrefix, lbName, probeName)),
-									},
-								},
-							}
-							rules = append(rules, rule)
-
-							// natRule := network.InboundNatRule{
-							// 	Name: to.StringPtr(fmt.Sprintf("natRuleUdp%d", i)),
-							// 	InboundNatRulePropertiesFormat: &network.InboundNatRulePropertiesFormat{
-							// 		Protocol:             network.TransportProtocolUDP,
-							// 		FrontendPort:         to.Int32Ptr(port),
-							// 		BackendPort:          to.Int32Ptr(port),
-							// 		EnableFloatingIP:     to.BoolPtr(false),
-							// 		IdleTimeoutInMinutes: to.Int32Ptr(5),
-							// 		FrontendIPConfiguration: &network.SubResource{
-							// 			ID: to.StringPtr(fmt.Sprintf("/%s/%s/frontendIPConfigurations/%s", idPrefix, lbName, frontEndIPConfigName)),
-							// 		},
-							// 	},
-							// }
-							// inboundNatRules = append(inboundNatRules, natRule)
-
-						}
-					}
-				}
+	tcpRules := 0
+	udpRules := 0
+	for _, ingressPort := range ingressPorts {
+		port := ingressPort.Port
+		protocol := network.TransportProtocolTCP
+		ruleName := fmt.Sprintf("lbRuleTcp%d", tcpRules)
+		if ingressPort.Protocol == SecurityProtocolUDP {
+			protocol = network.TransportProtocolUDP
+			ruleName = fmt.Sprintf("lbRuleUdp%d", udpRules)
+			udpRules++
+		} else {
+			if tcpRules == 0 {
+				healthCheckPort = port
 			}
+			tcpRules++
+		}
+
+		rule := network.LoadBalancingRule{
+			Name: to.StringPtr(ruleName),
+			LoadBalancingRulePropertiesFormat: &network.LoadBalancingRulePropertiesFormat{
+				Protocol:             protocol,
+				FrontendPort:         to.Int32Ptr(port),
+				BackendPort:          to.Int32Ptr(port),
+				IdleTimeoutInMinutes: to.Int32Ptr(4),
+				EnableFloatingIP:     to.BoolPtr(false),
+				LoadDistribution:     network.LoadDistributionDefault,
+				FrontendIPConfiguration: &network.SubResource{
+					ID: to.StringPtr(fmt.Sprintf("/%s/%s/frontendIPConfigurations/%s", idPrefix, lbName, frontEndIPConfigName)),
+				},
+				BackendAddressPool: &network.SubResource{
+					ID: to.StringPtr(fmt.Sprintf("/%s/%s/backendAddressPools/%s", idPrefix, lbName, backEndAddressPoolName)),
+				},
+				Probe: &network.SubResource{
+					ID: to.StringPtr(fmt.Sprintf("/%s/%s/probes/%s", idPrefix, lbName, probeName)),
+				},
+			},
 		}
+		rules = append(rules, rule)
 	}
 
 	future, err := lbClient.CreateOrUpdate(ctx,
@@ -632,6 +989,7 @@ func CreateLoadBalancer(ctx context.Context, lbName, location, pipName, groupNam
 		lbName,
 		network.LoadBalancer{
 			Location: to.StringPtr(location),
+			Tags:     lbTags,
 			LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
 				FrontendIPConfigurations: &[]network.FrontendIPConfiguration{
 					{
@@ -695,12 +1053,26 @@ func GetPublicIP(ctx context.Context, ipName, groupName string, tc *provide.Targ
 }
 
 // CreatePublicIP creates public IP address
-func CreatePublicIP(ctx context.Context, ipName, location, groupName string, tc *provide.TargetCredentials) (ip *network.PublicIPAddress, err error) {
+func CreatePublicIP(ctx context.Context, ipName, location, groupName string, tc *provide.TargetCredentials, tags map[string]string) (ip *network.PublicIPAddress, err error) {
 	ipClient, err := NewIPClient(tc)
 	if err != nil {
 		return nil, fmt.Errorf("failed to init public IP client; %s", err.Error())
 	}
 
+	ipTags, err := resourceTags(tags)
+	if err != nil {
+		return ip, fmt.Errorf("cannot create public ip address: %v", err)
+	}
+
+	existing, err := ipClient.Get(ctx, groupName, ipName, "")
+	if err != nil && !isNotFound(err) {
+		return ip, fmt.Errorf("failed to get public ip address; %s", err.Error())
+	}
+	ipTags, err = upsertedResourceTags(ipTags, existing.Tags, err == nil)
+	if err != nil {
+		return ip, fmt.Errorf("cannot create public ip address: %v", err)
+	}
+
 	future, err := ipClient.CreateOrUpdate(
 		ctx,
 		groupName,
@@ -708,6 +1080,7 @@ func CreatePublicIP(ctx context.Context, ipName, location, groupName string, tc
 		network.PublicIPAddress{
 			Name:     to.StringPtr(ipName),
 			Location: to.StringPtr(location),
+			Tags:     ipTags,
 			PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
 				PublicIPAddressVersion:   network.IPv4,
 				PublicIPAllocationMethod: network.Static,
@@ -2,12 +2,13 @@ package azurewrapper
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"testing"
 	"time"
 
 	"github.com/Azure/go-autorest/autorest/to"
-	provide "github.com/provideplatform/provide-go/api/nchain"
+	provide "github.com/provideplatform/provide-go/api/c2"
 )
 
 // type testData struct {
@@ -61,13 +62,13 @@ func TestStartContainer(t *testing.T) {
 		Security:          security,
 	}
 
-	_, err := UpsertResourceGroup(ctx, tc, region, groupName)
+	_, err := UpsertResourceGroup(ctx, tc, region, groupName, nil)
 	if err != nil {
 		println(fmt.Sprintf("cannot create group: %v", err.Error()))
 	}
 
 	// container, ids, err := StartContainer(params)
-	result, err := StartContainer(params, tc)
+	result, err := StartContainer(ctx, params, tc)
 	if err != nil {
 		panic(fmt.Sprintf("%s", err.Error()))
 	}
@@ -96,7 +97,7 @@ func TestUpsertResourceGroup(t *testing.T) {
 	defer cancel()
 	region := "eastus"
 	groupName := "skynetTest"
-	_, err := UpsertResourceGroup(ctx, tc, region, groupName)
+	_, err := UpsertResourceGroup(ctx, tc, region, groupName, nil)
 	if err != nil {
 		println(fmt.Sprintf("cannot create group: %v", err.Error()))
 	}
@@ -114,7 +115,7 @@ func TestUpsertVirtualNetwork(t *testing.T) {
 	region := "eastus"
 	groupName := "skynet"
 	vnetName := "skynet-vpc"
-	vnet, err := UpsertVirtualNetwork(ctx, tc, groupName, vnetName, region)
+	vnet, err := UpsertVirtualNetwork(ctx, tc, groupName, vnetName, region, nil, nil)
 	if err != nil {
 		panic(fmt.Sprintf("virtual network creation failed"))
 	}
@@ -143,9 +144,9 @@ func TestCreateLoadBalancer(t *testing.T) {
 			},
 		},
 	}
-	ip, err := CreatePublicIP(ctx, ipName, region, groupName, tc)
+	ip, err := CreatePublicIP(ctx, ipName, region, groupName, tc, nil)
 	println(fmt.Sprintf("ip: %+v", ip))
-	lb, err := CreateLoadBalancer(ctx, lbName, region, ipName, groupName, tc, security)
+	lb, err := CreateLoadBalancer(ctx, lbName, region, ipName, groupName, tc, security, nil)
 	if err != nil {
 		println(fmt.Sprintf("cannot create load balancer: %v", err.Error()))
 	}
@@ -157,3 +158,26 @@ func TestCreateLoadBalancer(t *testing.T) {
 		println(fmt.Sprintf("cannot delete load balancer: %v", err.Error()))
 	}
 }
+
+func TestCancelledContainerStartReportsLeftBehind(t *testing.T) {
+	params := &provide.ContainerParams{
+		ResourceGroupName:  "skynet",
+		ContainerGroupName: to.StringPtr("node"),
+	}
+
+	err := cancelledContainerStart(tc, params, nil, context.Canceled)
+	cancelErr, ok := err.(*ContainerStartCancelledError)
+	if !ok {
+		t.Fatalf("expected container start cancelled error; got %T", err)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected cancelled error to wrap context error")
+	}
+	if cancelErr.CleanedUp {
+		t.Errorf("expected container group not to be cleaned up")
+	}
+	expected := fmt.Sprintf("/subscriptions/%s/resourceGroups/skynet/providers/Microsoft.ContainerInstance/containerGroups/node", *tc.AzureSubscriptionID)
+	if len(cancelErr.LeftBehind) != 1 || cancelErr.LeftBehind[0] != expected {
+		t.Errorf("expected container group to be reported as left behind; got %v", cancelErr.LeftBehind)
+	}
+}
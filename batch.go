@@ -0,0 +1,236 @@
+package azurewrapper
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+
+	"github.com/Azure/go-autorest/autorest/to"
+
+	provide "github.com/provideplatform/provide-go/api/c2"
+)
+
+const defaultBatchConcurrency = 5
+const batchIDLength = 8
+const containerGroupNameMaxLength = 63
+
+// ContainerBatchFailurePolicy determines how StartContainers handles replicas which fail to start
+type ContainerBatchFailurePolicy string
+
+const (
+	// ContainerBatchFailurePolicyBestEffort keeps the replicas which started; failures are reported per replica
+	ContainerBatchFailurePolicyBestEffort ContainerBatchFailurePolicy = "best_effort"
+	// ContainerBatchFailurePolicyAllOrNothing stops starting replicas after the first failure and deletes
+	// every replica of the batch
+	ContainerBatchFailurePolicyAllOrNothing ContainerBatchFailurePolicy = "all_or_nothing"
+)
+
+// ContainerBatchOptions is a struct representing the params used to start a batch of identical replicas;
+// replica container groups are named `<container group name>-<batch id>-<index>`, where the batch id is generated
+// for each batch so replicas of a rerun batch never collide with replicas of a previous one
+type ContainerBatchOptions struct {
+	Replicas      int
+	Concurrency   int
+	FailurePolicy ContainerBatchFailurePolicy
+}
+
+// ContainerReplicaResult is the outcome of starting a single replica of a batch
+type ContainerReplicaResult struct {
+	Index              int
+	ContainerGroupName string
+	Result             *provide.ContainerCreateResult
+	Err                error
+
+	// Skipped is true if the replica was never attempted since the batch was cancelled after another replica failed
+	Skipped bool
+
+	// Submitted is true if the container group deployment of the replica was accepted by Azure
+	Submitted bool
+
+	RolledBack bool
+}
+
+// ContainerBatchResult is the outcome of starting a batch of replicas, ordered by replica index
+type ContainerBatchResult struct {
+	BatchID  string
+	Replicas []*ContainerReplicaResult
+}
+
+// Started returns the replicas which started and were not rolled back
+func (r *ContainerBatchResult) Started() []*ContainerReplicaResult {
+	started := make([]*ContainerReplicaResult, 0)
+	for _, replica := range r.Replicas {
+		if replica.Err == nil && !replica.RolledBack {
+			started = append(started, replica)
+		}
+	}
+	return started
+}
+
+// Failed returns the replicas which were attempted but failed to start
+func (r *ContainerBatchResult) Failed() []*ContainerReplicaResult {
+	failed := make([]*ContainerReplicaResult, 0)
+	for _, replica := range r.Replicas {
+		if replica.Err != nil && !replica.Skipped {
+			failed = append(failed, replica)
+		}
+	}
+	return failed
+}
+
+// Skipped returns the replicas which were never attempted
+func (r *ContainerBatchResult) Skipped() []*ContainerReplicaResult {
+	skipped := make([]*ContainerReplicaResult, 0)
+	for _, replica := range r.Replicas {
+		if replica.Skipped {
+			skipped = append(skipped, replica)
+		}
+	}
+	return skipped
+}
+
+// StartContainers starts the given number of identical replicas of the container params with bounded concurrency;
+// under the all-or-nothing policy an error is returned if any replica fails, after every replica whose deployment
+// was submitted has been deleted. Under the best-effort policy, per-replica errors are only reported in the result
+func StartContainers(ctx context.Context, cp *provide.ContainerParams, tc *provide.TargetCredentials, opts *ContainerOptions, batch *ContainerBatchOptions) (*ContainerBatchResult, error) {
+	if cp.ContainerGroupName == nil {
+		return nil, fmt.Errorf("Unable to start containers in region: %s; container group name is required", cp.Region)
+	}
+	if batch == nil || batch.Replicas < 1 {
+		return nil, fmt.Errorf("Unable to start containers in region: %s; at least one replica is required", cp.Region)
+	}
+
+	failurePolicy := batch.FailurePolicy
+	if failurePolicy == "" {
+		failurePolicy = ContainerBatchFailurePolicyBestEffort
+	}
+	if failurePolicy != ContainerBatchFailurePolicyBestEffort && failurePolicy != ContainerBatchFailurePolicyAllOrNothing {
+		return nil, fmt.Errorf("Unable to start containers in region: %s; unsupported failure policy: %s", cp.Region, failurePolicy)
+	}
+
+	concurrency := batch.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultBatchConcurrency
+	}
+	if concurrency > batch.Replicas {
+		concurrency = batch.Replicas
+	}
+
+	batchID, err := containerBatchID()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to start containers in region: %s; %s", cp.Region, err.Error())
+	}
+	if name := containerReplicaName(*cp.ContainerGroupName, batchID, batch.Replicas-1); len(name) > containerGroupNameMaxLength {
+		return nil, fmt.Errorf("Unable to start containers in region: %s; replica container group name %s exceeds %d characters", cp.Region, name, containerGroupNameMaxLength)
+	}
+
+	batchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	result := &ContainerBatchResult{
+		BatchID:  batchID,
+		Replicas: make([]*ContainerReplicaResult, batch.Replicas),
+	}
+
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < batch.Replicas; i++ {
+		replicaParams, replicaOpts := containerReplica(cp, opts, batchID, i)
+		replica := &ContainerReplicaResult{
+			Index:              i,
+			ContainerGroupName: *replicaParams.ContainerGroupName,
+		}
+		result.Replicas[i] = replica
+
+		select {
+		case sem <- struct{}{}:
+		case <-batchCtx.Done():
+			replica.Err = fmt.Errorf("replica %s was not started; %s", replica.ContainerGroupName, batchCtx.Err().Error())
+			replica.Skipped = true
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			replica.Result, replica.Submitted, replica.Err = startContainerWithOptions(batchCtx, replicaParams, tc, replicaOpts)
+			if replica.Err != nil {
+				log.Warningf("failed to start replica %s; %s", replica.ContainerGroupName, replica.Err.Error())
+				if failurePolicy == ContainerBatchFailurePolicyAllOrNothing {
+					cancel()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	failed := result.Failed()
+	if len(failed) == 0 || failurePolicy == ContainerBatchFailurePolicyBestEffort {
+		return result, nil
+	}
+
+	rollbackContainerReplicas(tc, cp.ResourceGroupName, result.Replicas, concurrency)
+	return result, fmt.Errorf("Unable to start containers in region: %s; %d of %d replicas failed and %d were not started; first error: %s", cp.Region, len(failed), batch.Replicas, len(result.Skipped()), failed[0].Err.Error())
+}
+
+// containerBatchID generates the random id which distinguishes the replicas of a batch from those of other batches
+func containerBatchID() (string, error) {
+	nonce := make([]byte, batchIDLength/2)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate batch id; %s", err.Error())
+	}
+	return hex.EncodeToString(nonce), nil
+}
+
+// containerReplicaName returns the container group name of the replica with the given index
+func containerReplicaName(containerGroupName, batchID string, index int) string {
+	return fmt.Sprintf("%s-%s-%d", containerGroupName, batchID, index)
+}
+
+// containerReplica returns the container params and options of the replica with the given index; explicit
+// DNS name labels are suffixed with the batch id and index, since labels must be unique within the region
+func containerReplica(cp *provide.ContainerParams, opts *ContainerOptions, batchID string, index int) (*provide.ContainerParams, *ContainerOptions) {
+	replicaParams := *cp
+	replicaParams.ContainerGroupName = to.StringPtr(containerReplicaName(*cp.ContainerGroupName, batchID, index))
+
+	if opts == nil {
+		return &replicaParams, nil
+	}
+
+	replicaOpts := *opts
+	if opts.DNSNameLabel != nil {
+		replicaOpts.DNSNameLabel = to.StringPtr(containerReplicaName(*opts.DNSNameLabel, batchID, index))
+	}
+	return &replicaParams, &replicaOpts
+}
+
+// rollbackContainerReplicas deletes every replica of the batch whose deployment was submitted, including failed
+// replicas which may have been partially created, using fresh contexts since the caller context may have expired;
+// replicas which were never submitted do not exist and are left as they are
+func rollbackContainerReplicas(tc *provide.TargetCredentials, resourceGroupName string, replicas []*ContainerReplicaResult, concurrency int) {
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for _, replica := range replicas {
+		if !replica.Submitted {
+			continue
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(replica *ContainerReplicaResult) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			err := cleanupContainerGroup(tc, resourceGroupName, replica.ContainerGroupName)
+			if err != nil {
+				log.Warningf("failed to roll back replica %s; %s", replica.ContainerGroupName, err.Error())
+				return
+			}
+			replica.RolledBack = true
+		}(replica)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,103 @@
+package azurewrapper
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+func TestContainerReplica(t *testing.T) {
+	cp := reconcileTestParams()
+	opts := &ContainerOptions{DNSNameLabel: to.StringPtr("nats")}
+
+	replicaParams, replicaOpts := containerReplica(cp, opts, "0a1b2c3d", 3)
+	if to.String(replicaParams.ContainerGroupName) != "nats-0a1b2c3d-3" {
+		t.Errorf("expected generated replica name; got %s", to.String(replicaParams.ContainerGroupName))
+	}
+	if to.String(replicaOpts.DNSNameLabel) != "nats-0a1b2c3d-3" {
+		t.Errorf("expected explicit DNS name label to be suffixed; got %s", to.String(replicaOpts.DNSNameLabel))
+	}
+	if to.String(cp.ContainerGroupName) != "nats" || to.String(opts.DNSNameLabel) != "nats" {
+		t.Errorf("expected original params and options to be unchanged")
+	}
+
+	_, replicaOpts = containerReplica(cp, nil, "0a1b2c3d", 0)
+	if replicaOpts != nil {
+		t.Errorf("expected nil options for replica without options")
+	}
+}
+
+func TestStartContainersValidation(t *testing.T) {
+	cp := reconcileTestParams()
+
+	_, err := StartContainers(context.Background(), cp, tc, nil, &ContainerBatchOptions{Replicas: 0})
+	if err == nil {
+		t.Errorf("expected error without replicas")
+	}
+
+	_, err = StartContainers(context.Background(), cp, tc, nil, &ContainerBatchOptions{Replicas: 2, FailurePolicy: "retry"})
+	if err == nil {
+		t.Errorf("expected error for unsupported failure policy")
+	}
+
+	cp.ContainerGroupName = to.StringPtr(strings.Repeat("n", containerGroupNameMaxLength-10))
+	_, err = StartContainers(context.Background(), cp, tc, nil, &ContainerBatchOptions{Replicas: 2})
+	if err == nil {
+		t.Errorf("expected error for replica names exceeding the maximum length")
+	}
+
+	cp.ContainerGroupName = nil
+	_, err = StartContainers(context.Background(), cp, tc, nil, &ContainerBatchOptions{Replicas: 2})
+	if err == nil {
+		t.Errorf("expected error without container group name")
+	}
+}
+
+func TestContainerBatchResult(t *testing.T) {
+	result := &ContainerBatchResult{
+		Replicas: []*ContainerReplicaResult{
+			{Index: 0, ContainerGroupName: "nats-0", Submitted: true},
+			{Index: 1, ContainerGroupName: "nats-1", Err: fmt.Errorf("quota exceeded")},
+			{Index: 2, ContainerGroupName: "nats-2", Submitted: true, RolledBack: true},
+			{Index: 3, ContainerGroupName: "nats-3", Err: fmt.Errorf("context canceled"), Skipped: true},
+		},
+	}
+
+	if started := result.Started(); len(started) != 1 || started[0].Index != 0 {
+		t.Errorf("expected only the replica which was not rolled back to be started; got %+v", started)
+	}
+	if failed := result.Failed(); len(failed) != 1 || failed[0].Index != 1 {
+		t.Errorf("expected a single failed replica; got %+v", failed)
+	}
+	if skipped := result.Skipped(); len(skipped) != 1 || skipped[0].Index != 3 {
+		t.Errorf("expected the replica which was never attempted to be reported separately; got %+v", skipped)
+	}
+}
+
+func TestContainerBatchID(t *testing.T) {
+	first, err := containerBatchID()
+	if err != nil || len(first) != batchIDLength {
+		t.Fatalf("expected batch id of %d characters; got %s", batchIDLength, first)
+	}
+	second, _ := containerBatchID()
+	if first == second {
+		t.Errorf("expected rerun batches to get distinct batch ids")
+	}
+}
+
+func TestRollbackContainerReplicasSkipsUnsubmitted(t *testing.T) {
+	replicas := []*ContainerReplicaResult{
+		{Index: 0, ContainerGroupName: "nats-0", Err: fmt.Errorf("invalid image")},
+		{Index: 1, ContainerGroupName: "nats-1", Err: fmt.Errorf("context canceled"), Skipped: true},
+	}
+
+	rollbackContainerReplicas(tc, "skynet", replicas, 2)
+	for _, replica := range replicas {
+		if replica.RolledBack {
+			t.Errorf("expected replica %s which was never submitted not to be rolled back", replica.ContainerGroupName)
+		}
+	}
+}
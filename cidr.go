@@ -0,0 +1,286 @@
+package azurewrapper
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-12-01/network"
+
+	provide "github.com/provideplatform/provide-go/api/c2"
+)
+
+const defaultSubnetName = "default"
+
+// VirtualNetworkAllocation is a struct representing the supernet from which virtual network address spaces
+// are allocated, and the prefix lengths of the allocated virtual network and subnet ranges
+type VirtualNetworkAllocation struct {
+	Supernet                   string
+	VirtualNetworkPrefixLength int
+	SubnetPrefixLength         int
+}
+
+// DefaultVirtualNetworkAllocation is used until ConfigureVirtualNetworkAllocation is called
+var DefaultVirtualNetworkAllocation = VirtualNetworkAllocation{
+	Supernet:                   "10.0.0.0/8",
+	VirtualNetworkPrefixLength: 16,
+	SubnetPrefixLength:         24,
+}
+
+var (
+	vnetAllocation      = DefaultVirtualNetworkAllocation
+	vnetAllocationMutex sync.Mutex
+
+	cidrAllocationMutex sync.Mutex
+)
+
+// ConfigureVirtualNetworkAllocation sets the supernet and prefix lengths used to allocate address ranges for
+// virtual networks and subnets upserted without an explicit range
+func ConfigureVirtualNetworkAllocation(allocation VirtualNetworkAllocation) error {
+	_, supernet, err := net.ParseCIDR(allocation.Supernet)
+	if err != nil || supernet.IP.To4() == nil {
+		return fmt.Errorf("invalid supernet: %s; an IPv4 CIDR is required", allocation.Supernet)
+	}
+	supernetOnes, _ := supernet.Mask.Size()
+	if allocation.VirtualNetworkPrefixLength < supernetOnes || allocation.VirtualNetworkPrefixLength > 29 {
+		return fmt.Errorf("invalid virtual network prefix length: %d; must be between %d and 29", allocation.VirtualNetworkPrefixLength, supernetOnes)
+	}
+	if allocation.SubnetPrefixLength < allocation.VirtualNetworkPrefixLength || allocation.SubnetPrefixLength > 29 {
+		return fmt.Errorf("invalid subnet prefix length: %d; must be between %d and 29", allocation.SubnetPrefixLength, allocation.VirtualNetworkPrefixLength)
+	}
+
+	vnetAllocationMutex.Lock()
+	defer vnetAllocationMutex.Unlock()
+	vnetAllocation = allocation
+	return nil
+}
+
+// CIDRAllocator allocates non-overlapping IPv4 ranges from a supernet
+type CIDRAllocator struct {
+	supernet  *net.IPNet
+	allocated []*net.IPNet
+	mutex     sync.Mutex
+}
+
+// NewCIDRAllocator initializes a CIDR allocator for the given supernet; the given ranges are considered allocated
+func NewCIDRAllocator(supernet string, allocated []string) (*CIDRAllocator, error) {
+	_, ipNet, err := net.ParseCIDR(supernet)
+	if err != nil || ipNet.IP.To4() == nil {
+		return nil, fmt.Errorf("invalid supernet: %s; an IPv4 CIDR is required", supernet)
+	}
+
+	allocator := &CIDRAllocator{
+		supernet:  ipNet,
+		allocated: make([]*net.IPNet, 0, len(allocated)),
+	}
+	for _, cidr := range allocated {
+		err := allocator.Reserve(cidr)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return allocator, nil
+}
+
+// NewSubscriptionCIDRAllocator initializes a CIDR allocator for the given supernet in which the address spaces
+// of the existing virtual networks in the subscription are considered allocated
+func NewSubscriptionCIDRAllocator(ctx context.Context, tc *provide.TargetCredentials, supernet string) (*CIDRAllocator, error) {
+	vnetClient, err := NewVirtualNetworksClient(tc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create virtual network client; %s", err.Error())
+	}
+
+	it, err := vnetClient.ListAllComplete(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list virtual networks; %s", err.Error())
+	}
+
+	allocated := make([]string, 0)
+	for it.NotDone() {
+		vnet := it.Value()
+		if vnet.VirtualNetworkPropertiesFormat != nil && vnet.AddressSpace != nil && vnet.AddressSpace.AddressPrefixes != nil {
+			allocated = append(allocated, *vnet.AddressSpace.AddressPrefixes...)
+		}
+
+		err = it.NextWithContext(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list virtual networks; %s", err.Error())
+		}
+	}
+
+	return NewCIDRAllocator(supernet, allocated)
+}
+
+// Reserve marks the given range as allocated; ranges outside of the supernet are ignored
+func (a *CIDRAllocator) Reserve(cidr string) error {
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return fmt.Errorf("invalid CIDR: %s", cidr)
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if ipNet.IP.To4() != nil && cidrsOverlap(a.supernet, ipNet) {
+		a.allocated = append(a.allocated, ipNet)
+	}
+	return nil
+}
+
+// Allocate returns the lowest free range of the given prefix length within the supernet and marks it as allocated
+func (a *CIDRAllocator) Allocate(prefixLength int) (string, error) {
+	supernetOnes, _ := a.supernet.Mask.Size()
+	if prefixLength < supernetOnes || prefixLength > 32 {
+		return "", fmt.Errorf("invalid prefix length: %d; must be between %d and 32", prefixLength, supernetOnes)
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	allocated := make([]*net.IPNet, len(a.allocated))
+	copy(allocated, a.allocated)
+	sort.Slice(allocated, func(i, j int) bool {
+		return ipv4ToUint32(allocated[i].IP) < ipv4ToUint32(allocated[j].IP)
+	})
+
+	blockSize := uint64(1) << uint(32-prefixLength)
+	start := uint64(ipv4ToUint32(a.supernet.IP))
+	end := start + (uint64(1) << uint(32-supernetOnes))
+
+	for candidate := start; candidate+blockSize <= end; {
+		next := candidate
+		for _, ipNet := range allocated {
+			rangeStart, rangeEnd := cidrRange(ipNet)
+			if rangeStart < candidate+blockSize && candidate < rangeEnd {
+				// skip to the first aligned block after the overlapping range
+				next = ((rangeEnd + blockSize - 1) / blockSize) * blockSize
+				break
+			}
+		}
+		if next == candidate {
+			ipNet := &net.IPNet{
+				IP:   uint32ToIPv4(uint32(candidate)),
+				Mask: net.CIDRMask(prefixLength, 32),
+			}
+			a.allocated = append(a.allocated, ipNet)
+			return ipNet.String(), nil
+		}
+		candidate = next
+	}
+
+	return "", fmt.Errorf("no free /%d range in %s", prefixLength, a.supernet.String())
+}
+
+// allocateVirtualNetworkSpec fills in the address space of the given spec, and the address prefixes of its subnets,
+// when they are not given; the ranges of the existing virtual network, if any, are reused so repeated upserts are stable
+func allocateVirtualNetworkSpec(ctx context.Context, tc *provide.TargetCredentials, existing *network.VirtualNetwork, spec *VirtualNetworkSpec) (*VirtualNetworkSpec, error) {
+	vnetAllocationMutex.Lock()
+	allocation := vnetAllocation
+	vnetAllocationMutex.Unlock()
+
+	allocated := &VirtualNetworkSpec{
+		AddressPrefixes: make([]string, 0),
+		Subnets:         make([]SubnetSpec, 0),
+	}
+	if spec == nil {
+		allocated.Subnets = append(allocated.Subnets, SubnetSpec{Name: defaultSubnetName})
+	} else {
+		allocated.AddressPrefixes = append(allocated.AddressPrefixes, spec.AddressPrefixes...)
+		allocated.Subnets = append(allocated.Subnets, spec.Subnets...)
+	}
+
+	existingSubnets := virtualNetworkSubnetPrefixes(existing)
+	if len(allocated.AddressPrefixes) == 0 && existing != nil && existing.VirtualNetworkPropertiesFormat != nil &&
+		existing.AddressSpace != nil && existing.AddressSpace.AddressPrefixes != nil {
+		allocated.AddressPrefixes = append(allocated.AddressPrefixes, *existing.AddressSpace.AddressPrefixes...)
+	}
+
+	if len(allocated.AddressPrefixes) == 0 {
+		allocator, err := NewSubscriptionCIDRAllocator(ctx, tc, allocation.Supernet)
+		if err != nil {
+			return nil, err
+		}
+		prefix, err := allocator.Allocate(allocation.VirtualNetworkPrefixLength)
+		if err != nil {
+			return nil, fmt.Errorf("failed to allocate virtual network address space; %s", err.Error())
+		}
+		allocated.AddressPrefixes = append(allocated.AddressPrefixes, prefix)
+	}
+
+	err := allocateSubnetPrefixes(allocated, existingSubnets, allocation.SubnetPrefixLength)
+	if err != nil {
+		return nil, err
+	}
+
+	return allocated, nil
+}
+
+// allocateSubnetPrefixes fills in the address prefixes of subnets which are not given, reusing the prefixes of
+// existing subnets by name and otherwise allocating the lowest free ranges within the virtual network address space
+// which do not overlap any given or existing subnet
+func allocateSubnetPrefixes(spec *VirtualNetworkSpec, existingSubnets map[string]string, prefixLength int) error {
+	allocators := make([]*CIDRAllocator, 0, len(spec.AddressPrefixes))
+	for _, addressPrefix := range spec.AddressPrefixes {
+		if ip, _, err := net.ParseCIDR(addressPrefix); err == nil && ip.To4() == nil {
+			// subnets are only allocated from the IPv4 address space of dual-stack virtual networks
+			continue
+		}
+		allocator, err := NewCIDRAllocator(addressPrefix, []string{})
+		if err != nil {
+			return err
+		}
+		for _, subnet := range spec.Subnets {
+			if subnet.AddressPrefix != "" {
+				allocator.Reserve(subnet.AddressPrefix)
+			}
+		}
+		for _, prefix := range existingSubnets {
+			allocator.Reserve(prefix)
+		}
+		allocators = append(allocators, allocator)
+	}
+
+	for i := range spec.Subnets {
+		subnet := &spec.Subnets[i]
+		if subnet.AddressPrefix != "" {
+			continue
+		}
+		if prefix, ok := existingSubnets[subnet.Name]; ok {
+			subnet.AddressPrefix = prefix
+			continue
+		}
+
+		for _, allocator := range allocators {
+			prefix, err := allocator.Allocate(prefixLength)
+			if err == nil {
+				subnet.AddressPrefix = prefix
+				break
+			}
+		}
+		if subnet.AddressPrefix == "" {
+			return fmt.Errorf("failed to allocate address prefix for subnet %s; no free /%d range in the virtual network address space", subnet.Name, prefixLength)
+		}
+	}
+
+	return nil
+}
+
+// cidrRange returns the first address of the network and the address following its last address
+func cidrRange(ipNet *net.IPNet) (uint64, uint64) {
+	ones, bits := ipNet.Mask.Size()
+	start := uint64(ipv4ToUint32(ipNet.IP.Mask(ipNet.Mask)))
+	return start, start + (uint64(1) << uint(bits-ones))
+}
+
+func ipv4ToUint32(ip net.IP) uint32 {
+	return binary.BigEndian.Uint32(ip.To4())
+}
+
+func uint32ToIPv4(n uint32) net.IP {
+	ip := make(net.IP, net.IPv4len)
+	binary.BigEndian.PutUint32(ip, n)
+	return ip
+}
@@ -0,0 +1,133 @@
+package azurewrapper
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCIDRAllocatorAllocate(t *testing.T) {
+	allocator, err := NewCIDRAllocator("10.0.0.0/8", []string{"10.0.0.0/16", "10.1.128.0/17", "192.168.0.0/16"})
+	if err != nil {
+		t.Errorf("failed to initialize allocator; %s", err.Error())
+		return
+	}
+
+	expected := []string{"10.2.0.0/16", "10.3.0.0/16"}
+	for _, cidr := range expected {
+		allocated, err := allocator.Allocate(16)
+		if err != nil {
+			t.Errorf("failed to allocate /16; %s", err.Error())
+			return
+		}
+		if allocated != cidr {
+			t.Errorf("expected %s to be allocated; got %s", cidr, allocated)
+		}
+	}
+
+	allocated, err := allocator.Allocate(24)
+	if err != nil || allocated != "10.1.0.0/24" {
+		t.Errorf("expected the lowest free /24 to be allocated; got %s", allocated)
+	}
+
+	if _, err := allocator.Allocate(4); err == nil {
+		t.Errorf("expected prefix length shorter than the supernet to be rejected")
+	}
+}
+
+func TestCIDRAllocatorExhausted(t *testing.T) {
+	allocator, _ := NewCIDRAllocator("172.20.0.0/23", []string{"172.20.1.0/24"})
+	if allocated, err := allocator.Allocate(24); err != nil || allocated != "172.20.0.0/24" {
+		t.Errorf("expected 172.20.0.0/24 to be allocated; got %s", allocated)
+	}
+	if _, err := allocator.Allocate(24); err == nil {
+		t.Errorf("expected exhausted supernet to return an error")
+	}
+}
+
+func TestAllocateSubnetPrefixes(t *testing.T) {
+	spec := &VirtualNetworkSpec{
+		AddressPrefixes: []string{"10.4.0.0/16"},
+		Subnets: []SubnetSpec{
+			{Name: "containers"},
+			{Name: "explicit", AddressPrefix: "10.4.0.0/24"},
+			{Name: "existing"},
+		},
+	}
+	err := allocateSubnetPrefixes(spec, map[string]string{"existing": "10.4.1.0/24"}, 24)
+	if err != nil {
+		t.Errorf("failed to allocate subnet prefixes; %s", err.Error())
+		return
+	}
+
+	if spec.Subnets[0].AddressPrefix != "10.4.2.0/24" {
+		t.Errorf("expected containers subnet to be allocated 10.4.2.0/24; got %s", spec.Subnets[0].AddressPrefix)
+	}
+	if spec.Subnets[2].AddressPrefix != "10.4.1.0/24" {
+		t.Errorf("expected existing subnet to keep 10.4.1.0/24; got %s", spec.Subnets[2].AddressPrefix)
+	}
+	if err := spec.validate(); err != nil {
+		t.Errorf("expected allocated spec to be valid; %s", err.Error())
+	}
+}
+
+func TestAllocateVirtualNetworkSpecExisting(t *testing.T) {
+	spec, err := allocateVirtualNetworkSpec(context.Background(), nil, existingTestVirtualNetwork(), nil)
+	if err != nil {
+		t.Errorf("failed to allocate spec for existing virtual network; %s", err.Error())
+		return
+	}
+
+	if len(spec.AddressPrefixes) != 1 || spec.AddressPrefixes[0] != "10.4.0.0/16" {
+		t.Errorf("expected existing address space to be reused; got %v", spec.AddressPrefixes)
+	}
+	if len(spec.Subnets) != 1 || spec.Subnets[0].AddressPrefix != "10.4.0.0/24" {
+		t.Errorf("expected existing default subnet prefix to be reused; got %+v", spec.Subnets)
+	}
+
+	spec, err = allocateVirtualNetworkSpec(context.Background(), nil, existingTestVirtualNetwork(), &VirtualNetworkSpec{Subnets: []SubnetSpec{{Name: "nodes"}}})
+	if err != nil {
+		t.Errorf("failed to allocate spec for existing virtual network; %s", err.Error())
+		return
+	}
+	if spec.Subnets[0].AddressPrefix != "10.4.2.0/24" {
+		t.Errorf("expected new subnet not to overlap existing subnets; got %s", spec.Subnets[0].AddressPrefix)
+	}
+	if err := spec.withPreservedSubnets(existingTestVirtualNetwork()).validate(); err != nil {
+		t.Errorf("expected allocated spec with preserved subnets to be valid; %s", err.Error())
+	}
+}
+
+func TestAllocateSubnetPrefixesDualStack(t *testing.T) {
+	spec := &VirtualNetworkSpec{
+		AddressPrefixes: []string{"fd00:db8::/48", "10.4.0.0/16"},
+		Subnets:         []SubnetSpec{{Name: "containers"}},
+	}
+	err := allocateSubnetPrefixes(spec, map[string]string{}, 24)
+	if err != nil {
+		t.Errorf("failed to allocate subnet prefixes in dual-stack virtual network; %s", err.Error())
+		return
+	}
+	if spec.Subnets[0].AddressPrefix != "10.4.0.0/24" {
+		t.Errorf("expected subnet to be allocated from the IPv4 address space; got %s", spec.Subnets[0].AddressPrefix)
+	}
+}
+
+func TestConfigureVirtualNetworkAllocation(t *testing.T) {
+	defer ConfigureVirtualNetworkAllocation(DefaultVirtualNetworkAllocation)
+
+	invalid := []VirtualNetworkAllocation{
+		{Supernet: "10.0.0.0", VirtualNetworkPrefixLength: 16, SubnetPrefixLength: 24},
+		{Supernet: "fd00::/8", VirtualNetworkPrefixLength: 16, SubnetPrefixLength: 24},
+		{Supernet: "10.0.0.0/16", VirtualNetworkPrefixLength: 8, SubnetPrefixLength: 24},
+		{Supernet: "10.0.0.0/8", VirtualNetworkPrefixLength: 16, SubnetPrefixLength: 12},
+	}
+	for _, allocation := range invalid {
+		if err := ConfigureVirtualNetworkAllocation(allocation); err == nil {
+			t.Errorf("expected invalid allocation to be rejected: %+v", allocation)
+		}
+	}
+
+	if err := ConfigureVirtualNetworkAllocation(VirtualNetworkAllocation{Supernet: "172.16.0.0/12", VirtualNetworkPrefixLength: 20, SubnetPrefixLength: 26}); err != nil {
+		t.Errorf("expected valid allocation; %s", err.Error())
+	}
+}
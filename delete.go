@@ -0,0 +1,339 @@
+package azurewrapper
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/containerinstance/mgmt/2018-10-01/containerinstance"
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-12-01/network"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/to"
+
+	provide "github.com/provideplatform/provide-go/api/c2"
+)
+
+const defaultDeletePollInterval = time.Second * 5
+const defaultDeleteTimeout = time.Minute * 5
+
+// ContainerDeleteOptions is a struct representing the params used to delete a container group and, optionally,
+// the dependent resources created for it
+type ContainerDeleteOptions struct {
+	// IgnoreNotFound treats a container group which does not exist as successfully deleted
+	IgnoreNotFound bool
+
+	Timeout      time.Duration
+	PollInterval time.Duration
+
+	// DeleteFileShares deletes the Azure file shares mounted as volumes in the container group which were created
+	// by CreateFileShare, unless they are still mounted by other container groups in its resource group; the storage
+	// accounts are expected in `StorageResourceGroupName`, which defaults to the container group resource group
+	DeleteFileShares         bool
+	StorageResourceGroupName string
+
+	// DeleteSecurityGroup deletes the network security group managed for the subnet into which the container group
+	// was deployed once no other container groups remain in the subnet; it is dissociated from the subnet first
+	DeleteSecurityGroup bool
+}
+
+// UnmanagedResourceError is returned when a resource which was not created by this package would be deleted
+type UnmanagedResourceError struct {
+	ResourceID string
+}
+
+func (e *UnmanagedResourceError) Error() string {
+	return fmt.Sprintf("resource %s is not managed by %s", e.ResourceID, managedByTagValue)
+}
+
+// ContainerDeleteResult is a struct representing the outcome of a container group deletion
+type ContainerDeleteResult struct {
+	// NotFound is true if the container group did not exist
+	NotFound bool
+
+	// ReleasedDNSNameLabel is the DNS name label released by Azure when the container group was deleted
+	ReleasedDNSNameLabel *string
+
+	// Deleted lists the IDs of the container group and the dependent resources which were deleted
+	Deleted []string
+
+	// Retained lists the IDs of the dependent resources which were not deleted since they are not managed
+	// by this package or are still in use
+	Retained []string
+}
+
+// DeleteContainerWithOptions deletes the given container group, waits until it no longer exists and optionally
+// cascades to dependent resources; all dependents are attempted even if one fails
+func DeleteContainerWithOptions(ctx context.Context, tc *provide.TargetCredentials, resourceGroupName, containerGroupName string, opts *ContainerDeleteOptions) (*ContainerDeleteResult, error) {
+	if opts == nil {
+		opts = &ContainerDeleteOptions{}
+	}
+
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = defaultDeleteTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cgClient, err := NewContainerGroupsClient(tc)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get container group client: %s; ", err.Error())
+	}
+
+	result := &ContainerDeleteResult{
+		Deleted:  make([]string, 0),
+		Retained: make([]string, 0),
+	}
+
+	var containerGroup *containerinstance.ContainerGroup
+	existing, err := cgClient.Get(ctx, resourceGroupName, containerGroupName)
+	if err != nil && !isNotFound(err) {
+		return nil, fmt.Errorf("Unable to get container group: %s; ", err.Error())
+	}
+	if err == nil {
+		containerGroup = &existing
+	}
+
+	if containerGroup != nil {
+		deleted, err := cgClient.Delete(ctx, resourceGroupName, containerGroupName)
+		if err != nil && !isNotFound(err) {
+			return nil, fmt.Errorf("Unable to delete container: %s; ", err.Error())
+		}
+		if err != nil || deleted.StatusCode == http.StatusNoContent {
+			containerGroup = nil
+		}
+	}
+
+	if containerGroup == nil {
+		if !opts.IgnoreNotFound {
+			return nil, fmt.Errorf("Unable to delete container: container group %s not found; ", containerGroupName)
+		}
+		result.NotFound = true
+	} else {
+		err = waitForContainerGroupDeletion(ctx, cgClient, resourceGroupName, containerGroupName, opts.PollInterval)
+		if err != nil {
+			return nil, err
+		}
+		result.Deleted = append(result.Deleted, containerGroupResourceID(tc, resourceGroupName, containerGroupName))
+		if containerGroup.IPAddress != nil {
+			result.ReleasedDNSNameLabel = containerGroup.IPAddress.DNSNameLabel
+		}
+	}
+
+	errs := make([]string, 0)
+
+	if opts.DeleteFileShares && containerGroup != nil {
+		storageResourceGroupName := opts.StorageResourceGroupName
+		if storageResourceGroupName == "" {
+			storageResourceGroupName = resourceGroupName
+		}
+
+		// the remaining container groups are listed only after the deletion completes, so the shares they mount
+		// are those still in use; no share is deleted if they cannot be listed
+		remaining, listErr := ListContainerGroups(ctx, tc, resourceGroupName, nil)
+		if listErr != nil {
+			errs = append(errs, fmt.Sprintf("failed to determine file shares in use; %s", listErr.Error()))
+		}
+
+		for _, share := range containerGroupFileShares(*containerGroup) {
+			accountName := to.String(share.StorageAccountName)
+			shareName := to.String(share.ShareName)
+			if listErr != nil || isFileShareMounted(remaining, containerGroupName, accountName, shareName) {
+				result.Retained = append(result.Retained, fileShareResourceID(tc, storageResourceGroupName, accountName, shareName))
+				continue
+			}
+
+			shareID, err := deleteFileShare(ctx, tc, storageResourceGroupName, accountName, shareName)
+			if unmanagedErr, ok := err.(*UnmanagedResourceError); ok {
+				result.Retained = append(result.Retained, unmanagedErr.ResourceID)
+				continue
+			}
+			if err != nil {
+				errs = append(errs, err.Error())
+				continue
+			}
+			if shareID != "" {
+				result.Deleted = append(result.Deleted, shareID)
+			}
+		}
+	}
+
+	if opts.DeleteSecurityGroup && containerGroup != nil {
+		deletedID, retainedID, err := deleteContainerGroupSecurityGroup(ctx, tc, *containerGroup)
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+		if deletedID != "" {
+			result.Deleted = append(result.Deleted, deletedID)
+		}
+		if retainedID != "" {
+			result.Retained = append(result.Retained, retainedID)
+		}
+	}
+
+	if len(errs) > 0 {
+		return result, fmt.Errorf("failed to delete dependent resources of container group %s; %v", containerGroupName, errs)
+	}
+
+	return result, nil
+}
+
+// waitForContainerGroupDeletion polls the container group until it no longer exists
+func waitForContainerGroupDeletion(ctx context.Context, cgClient containerinstance.ContainerGroupsClient, resourceGroupName, containerGroupName string, pollInterval time.Duration) error {
+	if pollInterval <= 0 {
+		pollInterval = defaultDeletePollInterval
+	}
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		_, err := cgClient.Get(ctx, resourceGroupName, containerGroupName)
+		if isNotFound(err) {
+			return nil
+		}
+		if err != nil && ctx.Err() == nil {
+			return fmt.Errorf("Unable to verify container group deletion: %s; ", err.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("container group %s was not deleted; %s", containerGroupName, ctx.Err().Error())
+		case <-ticker.C:
+		}
+	}
+}
+
+// containerGroupFileShares returns the Azure file shares mounted as volumes in the given container group
+func containerGroupFileShares(containerGroup containerinstance.ContainerGroup) []containerinstance.AzureFileVolume {
+	shares := make([]containerinstance.AzureFileVolume, 0)
+	if containerGroup.ContainerGroupProperties == nil || containerGroup.Volumes == nil {
+		return shares
+	}
+	for _, volume := range *containerGroup.Volumes {
+		if volume.AzureFile != nil && volume.AzureFile.ShareName != nil && volume.AzureFile.StorageAccountName != nil {
+			shares = append(shares, *volume.AzureFile)
+		}
+	}
+	return shares
+}
+
+// isFileShareMounted returns true if the given Azure file share is mounted as a volume in any of the given container
+// groups other than the named one
+func isFileShareMounted(containerGroups []containerinstance.ContainerGroup, containerGroupName, accountName, shareName string) bool {
+	for _, containerGroup := range containerGroups {
+		if strings.EqualFold(to.String(containerGroup.Name), containerGroupName) {
+			continue
+		}
+		for _, share := range containerGroupFileShares(containerGroup) {
+			if strings.EqualFold(to.String(share.StorageAccountName), accountName) && to.String(share.ShareName) == shareName {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// fileShareResourceID returns the ARM resource ID of the given Azure file share
+func fileShareResourceID(tc *provide.TargetCredentials, resourceGroupName, accountName, shareName string) string {
+	return fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Storage/storageAccounts/%s/fileServices/default/shares/%s", *tc.AzureSubscriptionID, resourceGroupName, accountName, shareName)
+}
+
+// deleteFileShare deletes the given Azure file share if it is managed by this package; it returns the ID of the
+// deleted file share, or an empty string if it did not exist, and an UnmanagedResourceError if it is not managed
+func deleteFileShare(ctx context.Context, tc *provide.TargetCredentials, resourceGroupName, accountName, shareName string) (string, error) {
+	sharesClient, err := NewFileSharesClient(tc)
+	if err != nil {
+		return "", fmt.Errorf("failed to create file shares client; %s", err.Error())
+	}
+
+	shareID := fileShareResourceID(tc, resourceGroupName, accountName, shareName)
+
+	share, err := sharesClient.Get(ctx, resourceGroupName, accountName, shareName)
+	if err != nil {
+		if isNotFound(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to get file share %s in storage account %s; %s", shareName, accountName, err.Error())
+	}
+	if share.FileShareProperties == nil || !isManagedResource(share.Metadata) {
+		return "", &UnmanagedResourceError{ResourceID: shareID}
+	}
+
+	_, err = sharesClient.Delete(ctx, resourceGroupName, accountName, shareName)
+	if err != nil && !isNotFound(err) {
+		return "", fmt.Errorf("failed to delete file share %s in storage account %s; %s", shareName, accountName, err.Error())
+	}
+
+	return shareID, nil
+}
+
+// deleteContainerGroupSecurityGroup deletes the network security group managed for the subnet into which the given
+// container group was deployed; it returns the ID of the deleted network security group, or the ID of the retained
+// network security group when it is not managed by this package or other container groups remain in the subnet
+func deleteContainerGroupSecurityGroup(ctx context.Context, tc *provide.TargetCredentials, containerGroup containerinstance.ContainerGroup) (string, string, error) {
+	if containerGroup.ContainerGroupProperties == nil || containerGroup.NetworkProfile == nil || containerGroup.NetworkProfile.ID == nil {
+		return "", "", nil
+	}
+
+	profileClient, err := NewProfilesClient(tc)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create network profile client; %s", err.Error())
+	}
+
+	profileID := *containerGroup.NetworkProfile.ID
+	profile, err := profileClient.Get(ctx, resourceIDSegment(profileID, "resourceGroups"), resourceIDSegment(profileID, "networkProfiles"), "")
+	if err != nil {
+		if isNotFound(err) {
+			return "", "", nil
+		}
+		return "", "", fmt.Errorf("failed to get network profile %s; %s", profileID, err.Error())
+	}
+
+	subnetID := networkProfileSubnetID(profile)
+	if subnetID == "" {
+		return "", "", nil
+	}
+
+	groupName := resourceIDSegment(subnetID, "resourceGroups")
+	securityGroupName := subnetSecurityGroupName(resourceIDSegment(subnetID, "virtualNetworks"), resourceIDSegment(subnetID, "subnets"))
+	if profile.ProfilePropertiesFormat != nil && profile.ContainerNetworkInterfaces != nil && len(*profile.ContainerNetworkInterfaces) > 0 {
+		return "", securityGroupResourceID(tc, groupName, securityGroupName), nil
+	}
+
+	securityGroupID, err := DeleteSecurityGroup(ctx, tc, groupName, securityGroupName)
+	if unmanagedErr, ok := err.(*UnmanagedResourceError); ok {
+		return "", unmanagedErr.ResourceID, nil
+	}
+	return securityGroupID, "", err
+}
+
+// networkProfileSubnetID returns the ID of the subnet to which the given network profile attaches container groups
+func networkProfileSubnetID(profile network.Profile) string {
+	if profile.ProfilePropertiesFormat == nil || profile.ContainerNetworkInterfaceConfigurations == nil {
+		return ""
+	}
+	for _, config := range *profile.ContainerNetworkInterfaceConfigurations {
+		if config.ContainerNetworkInterfaceConfigurationPropertiesFormat == nil || config.IPConfigurations == nil {
+			continue
+		}
+		for _, ipConfig := range *config.IPConfigurations {
+			if ipConfig.IPConfigurationProfilePropertiesFormat != nil && ipConfig.Subnet != nil && ipConfig.Subnet.ID != nil {
+				return *ipConfig.Subnet.ID
+			}
+		}
+	}
+	return ""
+}
+
+// isNotFound returns true if the given error is an Azure API error with a 404 status code
+func isNotFound(err error) bool {
+	if detailedErr, ok := err.(autorest.DetailedError); ok {
+		if statusCode, ok := detailedErr.StatusCode.(int); ok {
+			return statusCode == http.StatusNotFound
+		}
+	}
+	return false
+}
@@ -0,0 +1,135 @@
+package azurewrapper
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/containerinstance/mgmt/2018-10-01/containerinstance"
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-12-01/network"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+func TestIsNotFound(t *testing.T) {
+	if !isNotFound(autorest.DetailedError{StatusCode: http.StatusNotFound}) {
+		t.Errorf("expected 404 to be treated as not found")
+	}
+	if isNotFound(autorest.DetailedError{StatusCode: http.StatusConflict}) {
+		t.Errorf("expected 409 not to be treated as not found")
+	}
+	if isNotFound(fmt.Errorf("not found")) || isNotFound(nil) {
+		t.Errorf("expected non-Azure errors not to be treated as not found")
+	}
+}
+
+func TestContainerGroupFileShares(t *testing.T) {
+	containerGroup := containerinstance.ContainerGroup{
+		ContainerGroupProperties: &containerinstance.ContainerGroupProperties{
+			Volumes: &[]containerinstance.Volume{
+				{
+					Name: to.StringPtr("data"),
+					AzureFile: &containerinstance.AzureFileVolume{
+						ShareName:          to.StringPtr("nats-data"),
+						StorageAccountName: to.StringPtr("skynetstorage"),
+					},
+				},
+				{
+					Name:     to.StringPtr("scratch"),
+					EmptyDir: map[string]interface{}{},
+				},
+			},
+		},
+	}
+
+	shares := containerGroupFileShares(containerGroup)
+	if len(shares) != 1 || to.String(shares[0].ShareName) != "nats-data" {
+		t.Errorf("expected the azure file share volume; got %+v", shares)
+	}
+
+	if len(containerGroupFileShares(containerinstance.ContainerGroup{})) != 0 {
+		t.Errorf("expected no file shares for container group without properties")
+	}
+}
+
+func TestIsFileShareMounted(t *testing.T) {
+	containerGroup := func(name, accountName, shareName string) containerinstance.ContainerGroup {
+		return containerinstance.ContainerGroup{
+			Name: to.StringPtr(name),
+			ContainerGroupProperties: &containerinstance.ContainerGroupProperties{
+				Volumes: &[]containerinstance.Volume{
+					{
+						Name: to.StringPtr("data"),
+						AzureFile: &containerinstance.AzureFileVolume{
+							ShareName:          to.StringPtr(shareName),
+							StorageAccountName: to.StringPtr(accountName),
+						},
+					},
+				},
+			},
+		}
+	}
+
+	containerGroups := []containerinstance.ContainerGroup{
+		containerGroup("nats", "skynetstorage", "nats-data"),
+		containerGroup("nats-replica", "SkynetStorage", "nats-data"),
+		containerGroup("redis", "skynetstorage", "redis-data"),
+	}
+	if !isFileShareMounted(containerGroups, "nats", "skynetstorage", "nats-data") {
+		t.Errorf("expected file share mounted by another container group to be in use")
+	}
+	if isFileShareMounted(containerGroups, "redis", "skynetstorage", "redis-data") {
+		t.Errorf("expected file share mounted only by the deleted container group not to be in use")
+	}
+	if isFileShareMounted(containerGroups[:1], "nats", "skynetstorage", "nats-data") {
+		t.Errorf("expected the deleted container group to be ignored")
+	}
+}
+
+func TestResourceIDSegment(t *testing.T) {
+	subnetID := "/subscriptions/abc/resourceGroups/skynet/providers/Microsoft.Network/virtualNetworks/skynet-vnet/subnets/subnet1"
+	if resourceIDSegment(subnetID, "resourceGroups") != "skynet" || resourceIDSegment(subnetID, "virtualNetworks") != "skynet-vnet" || resourceIDSegment(subnetID, "subnets") != "subnet1" {
+		t.Errorf("expected resource ID segments to be parsed from %s", subnetID)
+	}
+	if resourceIDSegment(subnetID, "networkInterfaces") != "" {
+		t.Errorf("expected empty segment for missing key")
+	}
+}
+
+func TestNetworkProfileSubnetID(t *testing.T) {
+	subnetID := "/subscriptions/abc/resourceGroups/skynet/providers/Microsoft.Network/virtualNetworks/skynet-vnet/subnets/subnet1"
+	profile := network.Profile{
+		ProfilePropertiesFormat: &network.ProfilePropertiesFormat{
+			ContainerNetworkInterfaceConfigurations: &[]network.ContainerNetworkInterfaceConfiguration{
+				{
+					ContainerNetworkInterfaceConfigurationPropertiesFormat: &network.ContainerNetworkInterfaceConfigurationPropertiesFormat{
+						IPConfigurations: &[]network.IPConfigurationProfile{
+							{
+								IPConfigurationProfilePropertiesFormat: &network.IPConfigurationProfilePropertiesFormat{
+									Subnet: &network.Subnet{ID: to.StringPtr(subnetID)},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	if networkProfileSubnetID(profile) != subnetID {
+		t.Errorf("expected subnet of the network profile to be returned")
+	}
+	if networkProfileSubnetID(network.Profile{}) != "" {
+		t.Errorf("expected no subnet for network profile without properties")
+	}
+}
+
+func TestDeleteContainerGroupSecurityGroupWithoutSubnet(t *testing.T) {
+	deletedID, retainedID, err := deleteContainerGroupSecurityGroup(context.Background(), tc, containerinstance.ContainerGroup{
+		ContainerGroupProperties: &containerinstance.ContainerGroupProperties{},
+	})
+	if err != nil || deletedID != "" || retainedID != "" {
+		t.Errorf("expected nothing to be deleted for container group without a network profile")
+	}
+}
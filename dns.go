@@ -0,0 +1,136 @@
+package azurewrapper
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/containerinstance/mgmt/2018-10-01/containerinstance"
+	"github.com/Azure/go-autorest/autorest/to"
+
+	provide "github.com/provideplatform/provide-go/api/c2"
+)
+
+const containerDNSZone = "azurecontainer.io"
+const dnsNameLabelMaxLength = 63
+const dnsNameLabelSuffixLength = 8
+
+// DNSNameLabelReusePolicy determines the scope within which the same requested DNS name label
+// resolves to the same generated label
+type DNSNameLabelReusePolicy string
+
+const (
+	// DNSNameLabelReusePolicyUnsecure uses the requested DNS name label verbatim
+	DNSNameLabelReusePolicyUnsecure DNSNameLabelReusePolicy = "Unsecure"
+
+	// DNSNameLabelReusePolicyTenant generates the same label for the requested label within the tenant
+	DNSNameLabelReusePolicyTenant DNSNameLabelReusePolicy = "TenantReuse"
+
+	// DNSNameLabelReusePolicySubscription generates the same label for the requested label within the subscription
+	DNSNameLabelReusePolicySubscription DNSNameLabelReusePolicy = "SubscriptionReuse"
+
+	// DNSNameLabelReusePolicyResourceGroup generates the same label for the requested label within the resource group
+	DNSNameLabelReusePolicyResourceGroup DNSNameLabelReusePolicy = "ResourceGroupReuse"
+
+	// DNSNameLabelReusePolicyNoReuse generates a unique label every time
+	DNSNameLabelReusePolicyNoReuse DNSNameLabelReusePolicy = "NoReuse"
+)
+
+var dnsNameLabelInvalidChars = regexp.MustCompile(`[^a-z0-9-]+`)
+var dnsNameLabelPattern = regexp.MustCompile(`^[a-z][a-z0-9-]{1,61}[a-z0-9]$`)
+
+// containerDNSNameLabel resolves the DNS name label for the container group; when no label is given, one is
+// derived from the container group name and made collision-resistant using the resource group reuse policy
+func containerDNSNameLabel(cp *provide.ContainerParams, tc *provide.TargetCredentials, label *string, policy DNSNameLabelReusePolicy) (*string, error) {
+	base := ""
+	if label != nil {
+		base = *label
+	} else if cp.ContainerGroupName != nil {
+		base = *cp.ContainerGroupName
+	}
+
+	if policy == "" {
+		if label != nil {
+			policy = DNSNameLabelReusePolicyUnsecure
+		} else {
+			policy = DNSNameLabelReusePolicyResourceGroup
+		}
+	}
+
+	if policy == DNSNameLabelReusePolicyUnsecure {
+		if !dnsNameLabelPattern.MatchString(base) {
+			return nil, fmt.Errorf("invalid DNS name label: %s; must be 3-63 lowercase letters, digits or hyphens, starting with a letter", base)
+		}
+		return to.StringPtr(base), nil
+	}
+
+	var seed string
+	switch policy {
+	case DNSNameLabelReusePolicyTenant:
+		seed = fmt.Sprintf("%s/%s", to.String(tc.AzureTenantID), base)
+	case DNSNameLabelReusePolicySubscription:
+		seed = fmt.Sprintf("%s/%s", to.String(tc.AzureSubscriptionID), base)
+	case DNSNameLabelReusePolicyResourceGroup:
+		seed = fmt.Sprintf("%s/%s/%s", to.String(tc.AzureSubscriptionID), strings.ToLower(cp.ResourceGroupName), base)
+	case DNSNameLabelReusePolicyNoReuse:
+		nonce := make([]byte, 16)
+		if _, err := rand.Read(nonce); err != nil {
+			return nil, fmt.Errorf("failed to generate DNS name label; %s", err.Error())
+		}
+		seed = fmt.Sprintf("%s/%s", hex.EncodeToString(nonce), base)
+	default:
+		return nil, fmt.Errorf("unsupported DNS name label reuse policy: %s", policy)
+	}
+
+	digest := sha256.Sum256([]byte(seed))
+	suffix := hex.EncodeToString(digest[:])[:dnsNameLabelSuffixLength]
+
+	prefix := dnsNameLabelInvalidChars.ReplaceAllString(strings.ToLower(base), "-")
+	prefix = strings.Trim(prefix, "-")
+	if prefix == "" || prefix[0] < 'a' || prefix[0] > 'z' {
+		prefix = "cg" + prefix
+	}
+	// the label is truncated after the prefix is added so it never exceeds the maximum length
+	if maxPrefixLength := dnsNameLabelMaxLength - dnsNameLabelSuffixLength - 1; len(prefix) > maxPrefixLength {
+		prefix = strings.TrimRight(prefix[:maxPrefixLength], "-")
+	}
+
+	return to.StringPtr(fmt.Sprintf("%s-%s", prefix, suffix)), nil
+}
+
+// containerGroupFQDN returns the FQDN of the container group, deriving it from the DNS name label and location when
+// Azure has not yet reported it
+func containerGroupFQDN(containerGroup containerinstance.ContainerGroup) *string {
+	if containerGroup.ContainerGroupProperties == nil || containerGroup.IPAddress == nil {
+		return nil
+	}
+	if containerGroup.IPAddress.Fqdn != nil && *containerGroup.IPAddress.Fqdn != "" {
+		return containerGroup.IPAddress.Fqdn
+	}
+	if containerGroup.IPAddress.DNSNameLabel == nil || containerGroup.Location == nil {
+		return nil
+	}
+	return to.StringPtr(fmt.Sprintf("%s.%s.%s", *containerGroup.IPAddress.DNSNameLabel, normalizeRegion(*containerGroup.Location), containerDNSZone))
+}
+
+// containerGroupNetworkInterface maps the IP address of the container group into a provider-neutral network interface
+func containerGroupNetworkInterface(containerGroup containerinstance.ContainerGroup) *provide.NetworkInterface {
+	intf := &provide.NetworkInterface{
+		Host:        containerGroupFQDN(containerGroup),
+		IPv4:        nil,
+		IPv6:        nil,
+		PrivateIPv4: nil,
+		PrivateIPv6: nil,
+	}
+	if containerGroup.ContainerGroupProperties != nil && containerGroup.IPAddress != nil {
+		if containerGroup.IPAddress.Type == containerinstance.Private {
+			intf.PrivateIPv4 = containerGroup.IPAddress.IP
+		} else {
+			intf.IPv4 = containerGroup.IPAddress.IP
+		}
+	}
+	return intf
+}
@@ -0,0 +1,111 @@
+package azurewrapper
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/containerinstance/mgmt/2018-10-01/containerinstance"
+	"github.com/Azure/go-autorest/autorest/to"
+
+	provide "github.com/provideplatform/provide-go/api/c2"
+)
+
+func TestContainerDNSNameLabelGenerated(t *testing.T) {
+	cp := &provide.ContainerParams{
+		ResourceGroupName:  "skynet",
+		ContainerGroupName: to.StringPtr("NATS_Server.01"),
+	}
+
+	label, err := containerDNSNameLabel(cp, tc, nil, "")
+	if err != nil {
+		t.Fatalf("failed to generate DNS name label; %s", err.Error())
+	}
+	if !dnsNameLabelPattern.MatchString(*label) {
+		t.Errorf("generated DNS name label is invalid: %s", *label)
+	}
+	if !strings.HasPrefix(*label, "nats-server-01-") {
+		t.Errorf("expected generated DNS name label to be derived from container group name; got %s", *label)
+	}
+
+	again, _ := containerDNSNameLabel(cp, tc, nil, "")
+	if *again != *label {
+		t.Errorf("expected resource group reuse policy to generate a stable label; got %s and %s", *label, *again)
+	}
+
+	other, _ := containerDNSNameLabel(&provide.ContainerParams{ResourceGroupName: "other", ContainerGroupName: cp.ContainerGroupName}, tc, nil, "")
+	if *other == *label {
+		t.Errorf("expected distinct labels across resource groups")
+	}
+
+	unique, _ := containerDNSNameLabel(cp, tc, nil, DNSNameLabelReusePolicyNoReuse)
+	if *unique == *label {
+		t.Errorf("expected no reuse policy to generate a unique label")
+	}
+}
+
+func TestContainerDNSNameLabelUnsecure(t *testing.T) {
+	cp := &provide.ContainerParams{ContainerGroupName: to.StringPtr("node")}
+
+	label, err := containerDNSNameLabel(cp, tc, to.StringPtr("my-node"), "")
+	if err != nil || *label != "my-node" {
+		t.Errorf("expected supplied DNS name label to be used verbatim")
+	}
+
+	_, err = containerDNSNameLabel(cp, tc, to.StringPtr("My_Node"), DNSNameLabelReusePolicyUnsecure)
+	if err == nil {
+		t.Errorf("expected error for invalid DNS name label")
+	}
+
+	long, err := containerDNSNameLabel(cp, tc, to.StringPtr(strings.Repeat("a", 80)), DNSNameLabelReusePolicySubscription)
+	if err != nil || len(*long) > dnsNameLabelMaxLength {
+		t.Errorf("expected generated DNS name label to be truncated; got %v", long)
+	}
+}
+
+func TestContainerDNSNameLabelLongGroupName(t *testing.T) {
+	names := []string{
+		strings.Repeat("a", 80),
+		"0" + strings.Repeat("a", 79),
+		strings.Repeat("1", 80),
+		"-" + strings.Repeat("9", 62),
+	}
+	for _, name := range names {
+		cp := &provide.ContainerParams{
+			ResourceGroupName:  "skynet",
+			ContainerGroupName: to.StringPtr(name),
+		}
+		label, err := containerDNSNameLabel(cp, tc, nil, "")
+		if err != nil {
+			t.Errorf("failed to generate DNS name label for %s; %s", name, err.Error())
+			continue
+		}
+		if len(*label) > dnsNameLabelMaxLength || !dnsNameLabelPattern.MatchString(*label) {
+			t.Errorf("generated DNS name label is invalid: %s (%d characters)", *label, len(*label))
+		}
+	}
+}
+
+func TestContainerGroupNetworkInterface(t *testing.T) {
+	containerGroup := containerinstance.ContainerGroup{
+		Location: to.StringPtr("East US"),
+		ContainerGroupProperties: &containerinstance.ContainerGroupProperties{
+			IPAddress: &containerinstance.IPAddress{
+				IP:           to.StringPtr("20.1.2.3"),
+				DNSNameLabel: to.StringPtr("node-abc"),
+			},
+		},
+	}
+
+	intf := containerGroupNetworkInterface(containerGroup)
+	if intf.Host == nil || *intf.Host != "node-abc.eastus.azurecontainer.io" {
+		t.Errorf("expected derived FQDN; got %v", intf.Host)
+	}
+	if intf.IPv4 == nil || *intf.IPv4 != "20.1.2.3" {
+		t.Errorf("expected public IPv4")
+	}
+
+	containerGroup.IPAddress.Fqdn = to.StringPtr("node-abc.eastus.azurecontainer.io")
+	if *containerGroupNetworkInterface(containerGroup).Host != *containerGroup.IPAddress.Fqdn {
+		t.Errorf("expected reported FQDN")
+	}
+}
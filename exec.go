@@ -0,0 +1,158 @@
+package azurewrapper
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/services/containerinstance/mgmt/2018-10-01/containerinstance"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/gorilla/websocket"
+
+	provide "github.com/provideplatform/provide-go/api/c2"
+)
+
+const defaultExecTerminalRows = int32(24)
+const defaultExecTerminalCols = int32(80)
+
+// ExecContainer starts the given command in a running container and returns an interactive session;
+// writes are delivered to the command's stdin and reads return its output
+func ExecContainer(ctx context.Context, tc *provide.TargetCredentials, resourceGroupName, containerGroupName, containerName, command string, rows, cols *int32) (io.ReadWriteCloser, error) {
+	cClient, err := NewContainerClient(tc)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get container client: %s; ", err.Error())
+	}
+
+	if rows == nil {
+		rows = to.Int32Ptr(defaultExecTerminalRows)
+	}
+	if cols == nil {
+		cols = to.Int32Ptr(defaultExecTerminalCols)
+	}
+
+	resp, err := cClient.ExecuteCommand(ctx, resourceGroupName, containerGroupName, containerName, containerinstance.ContainerExecRequest{
+		Command: to.StringPtr(command),
+		TerminalSize: &containerinstance.ContainerExecRequestTerminalSize{
+			Rows: rows,
+			Cols: cols,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to execute command in container: %s; ", err.Error())
+	}
+	if resp.WebSocketURI == nil || resp.Password == nil {
+		return nil, fmt.Errorf("Unable to execute command in container: missing websocket uri or password; ")
+	}
+
+	return dialContainerExec(ctx, *resp.WebSocketURI, *resp.Password)
+}
+
+// RunContainerCommand executes the given command in a running container and returns its output once the
+// command exits and the session is closed by the container, or the context is cancelled
+func RunContainerCommand(ctx context.Context, tc *provide.TargetCredentials, resourceGroupName, containerGroupName, containerName, command string) (string, error) {
+	session, err := ExecContainer(ctx, tc, resourceGroupName, containerGroupName, containerName, command, nil, nil)
+	if err != nil {
+		return "", err
+	}
+
+	return readContainerExecOutput(ctx, session)
+}
+
+// readContainerExecOutput reads the session output until it is closed or the context is cancelled
+func readContainerExecOutput(ctx context.Context, session io.ReadCloser) (string, error) {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			session.Close()
+		case <-done:
+		}
+	}()
+
+	var output bytes.Buffer
+	_, err := io.Copy(&output, session)
+	session.Close()
+	if ctx.Err() != nil {
+		return output.String(), fmt.Errorf("container command did not complete; %s", ctx.Err().Error())
+	}
+	if err != nil {
+		return output.String(), fmt.Errorf("failed to read container command output; %s", err.Error())
+	}
+
+	return output.String(), nil
+}
+
+// containerExecConn adapts the container exec websocket to an io.ReadWriteCloser
+type containerExecConn struct {
+	conn    *websocket.Conn
+	reader  io.Reader
+	readMu  sync.Mutex
+	writeMu sync.Mutex
+}
+
+// dialContainerExec connects to the exec websocket and authenticates using the given password
+func dialContainerExec(ctx context.Context, uri, password string) (*containerExecConn, error) {
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, uri, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to container exec websocket; %s", err.Error())
+	}
+
+	err = conn.WriteMessage(websocket.TextMessage, []byte(password))
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to authenticate container exec websocket; %s", err.Error())
+	}
+
+	return &containerExecConn{conn: conn}, nil
+}
+
+// Read reads the command output, returning io.EOF once the container closes the session
+func (c *containerExecConn) Read(p []byte) (int, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+
+	for {
+		if c.reader != nil {
+			n, err := c.reader.Read(p)
+			if err != io.EOF {
+				return n, err
+			}
+			c.reader = nil
+			if n > 0 {
+				return n, nil
+			}
+		}
+
+		_, reader, err := c.conn.NextReader()
+		if err != nil {
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseNoStatusReceived) {
+				return 0, io.EOF
+			}
+			return 0, err
+		}
+		c.reader = reader
+	}
+}
+
+// Write sends the given input to the command's stdin
+func (c *containerExecConn) Write(p []byte) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	err := c.conn.WriteMessage(websocket.TextMessage, p)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close closes the exec session
+func (c *containerExecConn) Close() error {
+	c.writeMu.Lock()
+	c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	c.writeMu.Unlock()
+	return c.conn.Close()
+}
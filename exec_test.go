@@ -0,0 +1,120 @@
+package azurewrapper
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const testExecPassword = "s3cr3t"
+
+// newTestExecServer starts a local stand-in for the container exec websocket which authenticates the
+// session, echoes the first stdin message and then closes the session
+func newTestExecServer(t *testing.T) *httptest.Server {
+	upgrader := websocket.Upgrader{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("failed to upgrade websocket; %s", err.Error())
+			return
+		}
+		defer conn.Close()
+
+		_, password, err := conn.ReadMessage()
+		if err != nil || string(password) != testExecPassword {
+			conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "unauthorized"))
+			return
+		}
+
+		conn.WriteMessage(websocket.TextMessage, []byte("ready\n"))
+
+		_, input, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		conn.WriteMessage(websocket.BinaryMessage, []byte("echo: "+string(input)))
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	}))
+}
+
+func testExecURI(server *httptest.Server) string {
+	return "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+func TestContainerExecSession(t *testing.T) {
+	server := newTestExecServer(t)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	session, err := dialContainerExec(ctx, testExecURI(server), testExecPassword)
+	if err != nil {
+		t.Fatalf("failed to dial container exec; %s", err.Error())
+	}
+
+	_, err = session.Write([]byte("hello\n"))
+	if err != nil {
+		t.Fatalf("failed to write to container exec session; %s", err.Error())
+	}
+
+	output, err := readContainerExecOutput(ctx, session)
+	if err != nil {
+		t.Fatalf("failed to read container exec output; %s", err.Error())
+	}
+	if output != "ready\necho: hello\n" {
+		t.Errorf("unexpected container exec output: %q", output)
+	}
+}
+
+func TestContainerExecUnauthorized(t *testing.T) {
+	server := newTestExecServer(t)
+	defer server.Close()
+
+	session, err := dialContainerExec(context.Background(), testExecURI(server), "wrong")
+	if err != nil {
+		t.Fatalf("failed to dial container exec; %s", err.Error())
+	}
+	defer session.Close()
+
+	_, err = ioutil.ReadAll(session)
+	if err == nil {
+		t.Errorf("expected error for rejected session")
+	}
+}
+
+func TestContainerExecCancelled(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	session, err := dialContainerExec(ctx, testExecURI(server), testExecPassword)
+	if err != nil {
+		t.Fatalf("failed to dial container exec; %s", err.Error())
+	}
+
+	_, err = readContainerExecOutput(ctx, session)
+	if err == nil {
+		t.Errorf("expected error when context is cancelled")
+	}
+}
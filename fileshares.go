@@ -0,0 +1,42 @@
+package azurewrapper
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/services/storage/mgmt/2019-06-01/storage"
+	"github.com/Azure/go-autorest/autorest/to"
+
+	provide "github.com/provideplatform/provide-go/api/c2"
+)
+
+// CreateFileShare creates an Azure file share of the given quota, in gigabytes, for mounting as a container group
+// volume; the share is marked as managed by this package in its metadata, so it may be deleted along with the
+// container groups which mount it
+func CreateFileShare(ctx context.Context, tc *provide.TargetCredentials, resourceGroupName, accountName, shareName string, quota int32, tags map[string]string) (*storage.FileShare, error) {
+	metadata, err := resourceTags(tags)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create file share: %v", err)
+	}
+	metadata, err = upsertedResourceTags(metadata, nil, false)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create file share: %v", err)
+	}
+
+	sharesClient, err := NewFileSharesClient(tc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file shares client; %s", err.Error())
+	}
+
+	share, err := sharesClient.Create(ctx, resourceGroupName, accountName, shareName, storage.FileShare{
+		FileShareProperties: &storage.FileShareProperties{
+			Metadata:   metadata,
+			ShareQuota: to.Int32Ptr(quota),
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot create file share %s in storage account %s: %v", shareName, accountName, err)
+	}
+
+	return &share, nil
+}
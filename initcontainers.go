@@ -0,0 +1,286 @@
+package azurewrapper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/Azure/azure-sdk-for-go/services/containerinstance/mgmt/2018-10-01/containerinstance"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/azure"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+// initContainersAPIVersion is the first container instance API version which supports init containers;
+// the vendored SDK predates it, so container groups with init containers are created, and the init containers
+// of existing container groups and their logs are retrieved, using raw requests
+const initContainersAPIVersion = "2019-12-01"
+
+// InitContainerParams is a struct representing a container which runs to completion, in order, before
+// the main container of the group is started; its logs are retrievable using ContainerLogs by name
+type InitContainerParams struct {
+	Name         string
+	Image        string
+	Command      []string
+	Environment  map[string]string
+	VolumeMounts []containerinstance.VolumeMount
+}
+
+// initContainerDefinition is the init container representation expected by the container instance API
+type initContainerDefinition struct {
+	Name       string                            `json:"name"`
+	Properties initContainerDefinitionProperties `json:"properties"`
+}
+
+type initContainerDefinitionProperties struct {
+	Image                *string                                  `json:"image,omitempty"`
+	Command              *[]string                                `json:"command,omitempty"`
+	EnvironmentVariables *[]containerinstance.EnvironmentVariable `json:"environmentVariables,omitempty"`
+	VolumeMounts         *[]containerinstance.VolumeMount         `json:"volumeMounts,omitempty"`
+}
+
+// validateInitContainers returns an error if the given init containers are not supported by the container group
+func validateInitContainers(osType containerinstance.OperatingSystemTypes, containerName string, initContainers []InitContainerParams) error {
+	if len(initContainers) == 0 {
+		return nil
+	}
+
+	if osType == containerinstance.Windows {
+		return fmt.Errorf("Windows container groups do not support init containers")
+	}
+
+	names := map[string]bool{containerName: true}
+	for _, initContainer := range initContainers {
+		if initContainer.Name == "" {
+			return fmt.Errorf("init container name is required")
+		}
+		if initContainer.Image == "" {
+			return fmt.Errorf("init container %s requires an image", initContainer.Name)
+		}
+		if names[initContainer.Name] {
+			return fmt.Errorf("duplicate container name: %s", initContainer.Name)
+		}
+		names[initContainer.Name] = true
+	}
+
+	return nil
+}
+
+// initContainerDefinitions maps the given init containers into the representation expected by the container instance API
+func initContainerDefinitions(initContainers []InitContainerParams) []initContainerDefinition {
+	definitions := make([]initContainerDefinition, 0, len(initContainers))
+	for _, initContainer := range initContainers {
+		properties := initContainerDefinitionProperties{
+			Image: to.StringPtr(initContainer.Image),
+		}
+		if len(initContainer.Command) > 0 {
+			command := make([]string, len(initContainer.Command))
+			copy(command, initContainer.Command)
+			properties.Command = &command
+		}
+		if len(initContainer.Environment) > 0 {
+			env := make([]containerinstance.EnvironmentVariable, 0, len(initContainer.Environment))
+			for k, v := range initContainer.Environment {
+				env = append(env, containerinstance.EnvironmentVariable{
+					Name:  to.StringPtr(k),
+					Value: to.StringPtr(v),
+				})
+			}
+			properties.EnvironmentVariables = &env
+		}
+		if len(initContainer.VolumeMounts) > 0 {
+			volumeMounts := make([]containerinstance.VolumeMount, len(initContainer.VolumeMounts))
+			copy(volumeMounts, initContainer.VolumeMounts)
+			properties.VolumeMounts = &volumeMounts
+		}
+
+		definitions = append(definitions, initContainerDefinition{
+			Name:       initContainer.Name,
+			Properties: properties,
+		})
+	}
+	return definitions
+}
+
+// containerGroupWithInitContainers returns the request body for the given container group with the init containers added
+func containerGroupWithInitContainers(containerGroup containerinstance.ContainerGroup, initContainers []InitContainerParams) (map[string]interface{}, error) {
+	raw, err := json.Marshal(containerGroup)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal container group; %s", err.Error())
+	}
+
+	var body map[string]interface{}
+	err = json.Unmarshal(raw, &body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal container group; %s", err.Error())
+	}
+
+	properties, _ := body["properties"].(map[string]interface{})
+	if properties == nil {
+		return nil, fmt.Errorf("container group properties are required")
+	}
+	properties["initContainers"] = initContainerDefinitions(initContainers)
+
+	return body, nil
+}
+
+// createOrUpdateContainerGroup starts the deployment of the given container group, using the init containers
+// API version when the options include init containers
+func createOrUpdateContainerGroup(ctx context.Context, cgClient containerinstance.ContainerGroupsClient, resourceGroupName, containerGroupName string, containerGroup containerinstance.ContainerGroup, opts *ContainerOptions) (containerinstance.ContainerGroupsCreateOrUpdateFuture, error) {
+	if opts == nil || len(opts.InitContainers) == 0 {
+		return cgClient.CreateOrUpdate(ctx, resourceGroupName, containerGroupName, containerGroup)
+	}
+
+	var future containerinstance.ContainerGroupsCreateOrUpdateFuture
+	body, err := containerGroupWithInitContainers(containerGroup, opts.InitContainers)
+	if err != nil {
+		return future, err
+	}
+
+	pathParameters := map[string]interface{}{
+		"containerGroupName": autorest.Encode("path", containerGroupName),
+		"resourceGroupName":  autorest.Encode("path", resourceGroupName),
+		"subscriptionId":     autorest.Encode("path", cgClient.SubscriptionID),
+	}
+	queryParameters := map[string]interface{}{
+		"api-version": initContainersAPIVersion,
+	}
+
+	preparer := autorest.CreatePreparer(
+		autorest.AsContentType("application/json; charset=utf-8"),
+		autorest.AsPut(),
+		autorest.WithBaseURL(cgClient.BaseURI),
+		autorest.WithPathParameters("/subscriptions/{subscriptionId}/resourceGroups/{resourceGroupName}/providers/Microsoft.ContainerInstance/containerGroups/{containerGroupName}", pathParameters),
+		autorest.WithJSON(body),
+		autorest.WithQueryParameters(queryParameters))
+	req, err := preparer.Prepare((&http.Request{}).WithContext(ctx))
+	if err != nil {
+		return future, autorest.NewErrorWithError(err, "containerinstance.ContainerGroupsClient", "CreateOrUpdate", nil, "Failure preparing request")
+	}
+
+	future, err = cgClient.CreateOrUpdateSender(req)
+	if err != nil {
+		return future, autorest.NewErrorWithError(err, "containerinstance.ContainerGroupsClient", "CreateOrUpdate", future.Response(), "Failure sending request")
+	}
+
+	return future, nil
+}
+
+// withInitContainersAPIVersion rewrites the api-version of the given request prepared by the vendored SDK
+func withInitContainersAPIVersion(req *http.Request) *http.Request {
+	query := req.URL.Query()
+	query.Set("api-version", initContainersAPIVersion)
+	req.URL.RawQuery = query.Encode()
+	return req
+}
+
+// listContainerLogsRequest prepares the request for the logs of the given container using the init containers
+// API version, which serves the logs of init containers as well as those of the other containers in the group
+func listContainerLogsRequest(ctx context.Context, cClient containerinstance.ContainerClient, resourceGroupName, containerGroupName, containerName string, tail *int32) (*http.Request, error) {
+	req, err := cClient.ListLogsPreparer(ctx, resourceGroupName, containerGroupName, containerName, tail)
+	if err != nil {
+		return nil, autorest.NewErrorWithError(err, "containerinstance.ContainerClient", "ListLogs", nil, "Failure preparing request")
+	}
+	return withInitContainersAPIVersion(req), nil
+}
+
+// listContainerLogs returns the logs of the given container, which may be an init container
+func listContainerLogs(ctx context.Context, cClient containerinstance.ContainerClient, resourceGroupName, containerGroupName, containerName string, tail *int32) (logs containerinstance.Logs, err error) {
+	req, err := listContainerLogsRequest(ctx, cClient, resourceGroupName, containerGroupName, containerName, tail)
+	if err != nil {
+		return logs, err
+	}
+
+	resp, err := cClient.ListLogsSender(req)
+	if err != nil {
+		logs.Response = autorest.Response{Response: resp}
+		return logs, autorest.NewErrorWithError(err, "containerinstance.ContainerClient", "ListLogs", resp, "Failure sending request")
+	}
+
+	logs, err = cClient.ListLogsResponder(resp)
+	if err != nil {
+		return logs, autorest.NewErrorWithError(err, "containerinstance.ContainerClient", "ListLogs", resp, "Failure responding to request")
+	}
+	return logs, nil
+}
+
+// getContainerGroupInitContainers returns the init containers of the given container group, which the vendored
+// SDK omits from the container groups it returns
+func getContainerGroupInitContainers(ctx context.Context, cgClient containerinstance.ContainerGroupsClient, resourceGroupName, containerGroupName string) ([]initContainerDefinition, error) {
+	req, err := cgClient.GetPreparer(ctx, resourceGroupName, containerGroupName)
+	if err != nil {
+		return nil, autorest.NewErrorWithError(err, "containerinstance.ContainerGroupsClient", "Get", nil, "Failure preparing request")
+	}
+
+	resp, err := cgClient.GetSender(withInitContainersAPIVersion(req))
+	if err != nil {
+		return nil, autorest.NewErrorWithError(err, "containerinstance.ContainerGroupsClient", "Get", resp, "Failure sending request")
+	}
+
+	var containerGroup struct {
+		Properties struct {
+			InitContainers []initContainerDefinition `json:"initContainers"`
+		} `json:"properties"`
+	}
+	err = autorest.Respond(
+		resp,
+		cgClient.ByInspecting(),
+		azure.WithErrorUnlessStatusCode(http.StatusOK),
+		autorest.ByUnmarshallingJSON(&containerGroup),
+		autorest.ByClosing())
+	if err != nil {
+		return nil, autorest.NewErrorWithError(err, "containerinstance.ContainerGroupsClient", "Get", resp, "Failure responding to request")
+	}
+
+	return containerGroup.Properties.InitContainers, nil
+}
+
+// diffInitContainers compares the existing init containers with the desired init containers and returns the
+// changed properties which require recreate and those which can be updated in place; removing every init container
+// requires recreate, since the vendored SDK cannot submit a container group without them
+func diffInitContainers(existing, desired []initContainerDefinition) (recreate, update []string) {
+	recreate = make([]string, 0)
+	update = make([]string, 0)
+
+	if len(existing) > 0 && len(desired) == 0 {
+		recreate = append(recreate, "init containers removed")
+		return recreate, update
+	}
+
+	existingNames := make([]string, 0, len(existing))
+	for _, initContainer := range existing {
+		existingNames = append(existingNames, initContainer.Name)
+	}
+	desiredNames := make([]string, 0, len(desired))
+	for _, initContainer := range desired {
+		desiredNames = append(desiredNames, initContainer.Name)
+	}
+	if !jsonEqual(existingNames, desiredNames) {
+		update = append(update, "init containers")
+		return recreate, update
+	}
+
+	for i, initContainer := range desired {
+		current := existing[i].Properties
+		name := initContainer.Name
+		if to.String(current.Image) != to.String(initContainer.Properties.Image) {
+			update = append(update, fmt.Sprintf("init container %s image", name))
+		}
+		if !jsonEqual(current.Command, initContainer.Properties.Command) && !(isEmptyCommand(current.Command) && isEmptyCommand(initContainer.Properties.Command)) {
+			update = append(update, fmt.Sprintf("init container %s command", name))
+		}
+		if !equalStringSets(environmentKeys(current.EnvironmentVariables), environmentKeys(initContainer.Properties.EnvironmentVariables)) {
+			update = append(update, fmt.Sprintf("init container %s environment", name))
+		}
+		if !jsonEqual(current.VolumeMounts, initContainer.Properties.VolumeMounts) && !(isEmptyVolumeMounts(current.VolumeMounts) && isEmptyVolumeMounts(initContainer.Properties.VolumeMounts)) {
+			update = append(update, fmt.Sprintf("init container %s volume mounts", name))
+		}
+	}
+
+	return recreate, update
+}
+
+func isEmptyCommand(command *[]string) bool {
+	return command == nil || len(*command) == 0
+}
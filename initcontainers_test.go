@@ -0,0 +1,157 @@
+package azurewrapper
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/containerinstance/mgmt/2018-10-01/containerinstance"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+func TestValidateInitContainers(t *testing.T) {
+	valid := []InitContainerParams{
+		{Name: "genesis", Image: "provide/genesis-fetcher:latest"},
+	}
+	if err := validateInitContainers(containerinstance.Linux, "nats", valid); err != nil {
+		t.Errorf("expected valid init containers; %s", err.Error())
+	}
+	if err := validateInitContainers(containerinstance.Windows, "nats", valid); err == nil {
+		t.Errorf("expected init containers to be rejected for Windows container groups")
+	}
+	if err := validateInitContainers(containerinstance.Linux, "genesis", valid); err == nil {
+		t.Errorf("expected init container name conflicting with the main container to be rejected")
+	}
+	if err := validateInitContainers(containerinstance.Linux, "nats", []InitContainerParams{{Name: "genesis"}}); err == nil {
+		t.Errorf("expected init container without image to be rejected")
+	}
+}
+
+func TestContainerGroupWithInitContainers(t *testing.T) {
+	cp := reconcileTestParams()
+	opts := &ContainerOptions{
+		InitContainers: []InitContainerParams{
+			{
+				Name:        "keygen",
+				Image:       "provide/keygen:latest",
+				Command:     []string{"/bin/keygen", "--out", "/keys"},
+				Environment: map[string]string{"KEY_TYPE": "ed25519"},
+				VolumeMounts: []containerinstance.VolumeMount{
+					{Name: to.StringPtr("keys"), MountPath: to.StringPtr("/keys")},
+				},
+			},
+		},
+	}
+
+	containerGroup, err := containerGroupFromParams(cp, tc, opts)
+	if err != nil {
+		t.Fatalf("expected container group; %s", err.Error())
+	}
+
+	body, err := containerGroupWithInitContainers(*containerGroup, opts.InitContainers)
+	if err != nil {
+		t.Fatalf("expected request body; %s", err.Error())
+	}
+
+	raw, _ := json.Marshal(body)
+	var decoded struct {
+		Properties struct {
+			Containers     []json.RawMessage `json:"containers"`
+			InitContainers []struct {
+				Name       string `json:"name"`
+				Properties struct {
+					Image                string   `json:"image"`
+					Command              []string `json:"command"`
+					EnvironmentVariables []struct {
+						Name  string `json:"name"`
+						Value string `json:"value"`
+					} `json:"environmentVariables"`
+				} `json:"properties"`
+			} `json:"initContainers"`
+		} `json:"properties"`
+	}
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		t.Fatalf("failed to decode request body; %s", err.Error())
+	}
+
+	if len(decoded.Properties.Containers) != 1 {
+		t.Errorf("expected the main container to be preserved")
+	}
+	if len(decoded.Properties.InitContainers) != 1 {
+		t.Fatalf("expected a single init container; got %d", len(decoded.Properties.InitContainers))
+	}
+	initContainer := decoded.Properties.InitContainers[0]
+	if initContainer.Name != "keygen" || initContainer.Properties.Image != "provide/keygen:latest" || len(initContainer.Properties.Command) != 3 {
+		t.Errorf("expected init container definition; got %+v", initContainer)
+	}
+	if len(initContainer.Properties.EnvironmentVariables) != 1 || initContainer.Properties.EnvironmentVariables[0].Value != "ed25519" {
+		t.Errorf("expected init container environment; got %+v", initContainer.Properties.EnvironmentVariables)
+	}
+}
+
+func TestListContainerLogsRequest(t *testing.T) {
+	cClient := containerinstance.NewContainerClient("sub")
+	req, err := listContainerLogsRequest(context.Background(), cClient, "skynet", "nats", "genesis", to.Int32Ptr(50))
+	if err != nil {
+		t.Fatalf("failed to prepare container logs request; %s", err.Error())
+	}
+
+	if req.URL.Query().Get("api-version") != initContainersAPIVersion {
+		t.Errorf("expected container logs to be requested using the init containers API version; got %s", req.URL.Query().Get("api-version"))
+	}
+	if req.URL.Query().Get("tail") != "50" {
+		t.Errorf("expected tail to be retained; got %s", req.URL.Query().Get("tail"))
+	}
+	if !strings.HasSuffix(req.URL.Path, "/containerGroups/nats/containers/genesis/logs") {
+		t.Errorf("expected logs of the named container; got %s", req.URL.Path)
+	}
+}
+
+func TestDiffInitContainers(t *testing.T) {
+	existing := initContainerDefinitions([]InitContainerParams{
+		{Name: "genesis", Image: "provide/genesis-fetcher:latest", Environment: map[string]string{"A": "1", "B": "2"}},
+	})
+
+	recreate, update := diffInitContainers(existing, initContainerDefinitions([]InitContainerParams{
+		{Name: "genesis", Image: "provide/genesis-fetcher:latest", Environment: map[string]string{"B": "2", "A": "1"}},
+	}))
+	if len(recreate) != 0 || len(update) != 0 {
+		t.Errorf("expected unchanged init containers; got %v and %v", recreate, update)
+	}
+
+	_, update = diffInitContainers(existing, initContainerDefinitions([]InitContainerParams{
+		{Name: "genesis", Image: "provide/genesis-fetcher:v2", Command: []string{"fetch"}},
+	}))
+	if len(update) != 3 {
+		t.Errorf("expected image, command and environment changes; got %v", update)
+	}
+
+	_, update = diffInitContainers(nil, existing)
+	if len(update) != 1 || update[0] != "init containers" {
+		t.Errorf("expected added init containers to be updated in place; got %v", update)
+	}
+
+	recreate, _ = diffInitContainers(existing, nil)
+	if len(recreate) != 1 {
+		t.Errorf("expected removal of every init container to require recreate; got %v", recreate)
+	}
+}
+
+func TestDiffContainerGroupInitContainers(t *testing.T) {
+	opts := &ContainerOptions{
+		InitContainers: []InitContainerParams{{Name: "genesis", Image: "provide/genesis-fetcher:latest"}},
+	}
+	desired, _ := containerGroupFromParams(reconcileTestParams(), tc, opts)
+	existing := existingContainerGroup(t, desired)
+
+	action, changes := diffContainerGroup(existing, *desired, nil, initContainerDefinitions(opts.InitContainers))
+	if action != ContainerGroupReconcileUpdate || len(changes) != 1 {
+		t.Errorf("expected init containers to be updated in place; got %s: %v", action, changes)
+	}
+
+	action, _ = diffContainerGroup(existing, *desired, initContainerDefinitions(opts.InitContainers), initContainerDefinitions(opts.InitContainers))
+	if action != ContainerGroupReconcileNoop {
+		t.Errorf("expected noop for unchanged init containers; got %s", action)
+	}
+}
@@ -0,0 +1,158 @@
+package azurewrapper
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/containerinstance/mgmt/2018-10-01/containerinstance"
+
+	provide "github.com/provideplatform/provide-go/api/c2"
+)
+
+const containerStateTerminated = "Terminated"
+const defaultJobPollInterval = time.Second * 5
+
+// ContainerJobResult is a struct representing the outcome of a run-to-completion container job
+type ContainerJobResult struct {
+	ContainerGroupName string
+	ExitCode           *int32
+	StartTime          *time.Time
+	FinishTime         *time.Time
+	DetailStatus       *string
+	Logs               *string
+}
+
+// Succeeded returns true if the job container exited with code 0
+func (r *ContainerJobResult) Succeeded() bool {
+	return r.ExitCode != nil && *r.ExitCode == 0
+}
+
+// RunJob runs the container described by the given params to completion using restart policy `Never`;
+// the container group is deleted if it does not terminate within the given timeout. Jobs run in the region of
+// the container params, so regions given in the options are rejected
+func RunJob(ctx context.Context, cp *provide.ContainerParams, tc *provide.TargetCredentials, opts *ContainerOptions, timeout time.Duration) (*ContainerJobResult, error) {
+	jobOpts := ContainerOptions{}
+	if opts != nil {
+		jobOpts = *opts
+	}
+	jobOpts.RestartPolicy = containerinstance.Never
+
+	if len(jobOpts.Regions) > 0 {
+		return nil, fmt.Errorf("Unable to run job in region: %s; failover regions are not supported for jobs", cp.Region)
+	}
+
+	loadContainerRegionResourceLimits(ctx, tc, cp)
+	containerGroupParams, err := containerGroupFromParams(cp, tc, &jobOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	err = preflightContainerGroupIfRequested(ctx, tc, cp, *containerGroupParams, &jobOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	cgClient, err := NewContainerGroupsClient(tc)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get container group client: %s; ", err.Error())
+	}
+
+	err = prepareContainerGroupSubnet(ctx, tc, cp, &jobOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	future, err := createOrUpdateContainerGroup(ctx, cgClient, cp.ResourceGroupName, *cp.ContainerGroupName, *containerGroupParams, &jobOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create job container group; %s", err.Error())
+	}
+
+	err = future.WaitForCompletionRef(ctx, cgClient.Client)
+	if err != nil {
+		if err := cleanupContainerGroup(tc, cp.ResourceGroupName, *cp.ContainerGroupName); err != nil {
+			log.Warningf("failed to delete job container group %s; %s", *cp.ContainerGroupName, err.Error())
+		}
+		return nil, fmt.Errorf("failed to create job container group; %s", err.Error())
+	}
+
+	result := &ContainerJobResult{
+		ContainerGroupName: *cp.ContainerGroupName,
+	}
+
+	ticker := time.NewTicker(defaultJobPollInterval)
+	defer ticker.Stop()
+
+	for {
+		containerGroup, err := cgClient.Get(ctx, cp.ResourceGroupName, *cp.ContainerGroupName)
+		if err != nil && ctx.Err() == nil {
+			return nil, fmt.Errorf("failed to get job container group; %s", err.Error())
+		}
+
+		if err == nil {
+			if state := jobContainerState(containerGroup, jobContainerName(cp)); state != nil && state.State != nil && *state.State == containerStateTerminated {
+				result.ExitCode = state.ExitCode
+				result.DetailStatus = state.DetailStatus
+				result.StartTime = dateTime(state.StartTime)
+				result.FinishTime = dateTime(state.FinishTime)
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			if err := cleanupContainerGroup(tc, cp.ResourceGroupName, *cp.ContainerGroupName); err != nil {
+				log.Warningf("failed to delete job container group %s; %s", *cp.ContainerGroupName, err.Error())
+			}
+			return nil, fmt.Errorf("job container group %s did not terminate; %s", *cp.ContainerGroupName, ctx.Err().Error())
+		case <-ticker.C:
+		}
+	}
+
+	cClient, err := NewContainerClient(tc)
+	if err != nil {
+		return result, fmt.Errorf("Unable to get container client: %s; ", err.Error())
+	}
+
+	logs, err := cClient.ListLogs(ctx, cp.ResourceGroupName, *cp.ContainerGroupName, jobContainerName(cp), nil)
+	if err != nil {
+		return result, fmt.Errorf("Unable to get container logs: %s; ", err.Error())
+	}
+	result.Logs = logs.Content
+
+	log.Debugf("job container group %s terminated with exit code %v", *cp.ContainerGroupName, result.ExitCode)
+	return result, nil
+}
+
+// jobContainerName returns the name of the job container; see containerGroupFromParams
+func jobContainerName(cp *provide.ContainerParams) string {
+	if cp.ContainerName != nil {
+		return *cp.ContainerName
+	}
+	return *cp.ContainerGroupName
+}
+
+// jobContainerState returns the current state of the named container
+func jobContainerState(containerGroup containerinstance.ContainerGroup, containerName string) *containerinstance.ContainerState {
+	if containerGroup.ContainerGroupProperties == nil || containerGroup.Containers == nil {
+		return nil
+	}
+
+	for _, container := range *containerGroup.Containers {
+		if container.Name == nil || *container.Name != containerName {
+			continue
+		}
+		if container.ContainerProperties == nil || container.InstanceView == nil {
+			return nil
+		}
+		return container.InstanceView.CurrentState
+	}
+
+	return nil
+}
@@ -0,0 +1,54 @@
+package azurewrapper
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/containerinstance/mgmt/2018-10-01/containerinstance"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+func TestJobContainerState(t *testing.T) {
+	containerGroup := containerinstance.ContainerGroup{
+		ContainerGroupProperties: &containerinstance.ContainerGroupProperties{
+			Containers: &[]containerinstance.Container{
+				{
+					Name:                to.StringPtr("sidecar"),
+					ContainerProperties: &containerinstance.ContainerProperties{},
+				},
+				{
+					Name: to.StringPtr("migrate"),
+					ContainerProperties: &containerinstance.ContainerProperties{
+						InstanceView: &containerinstance.ContainerPropertiesInstanceView{
+							CurrentState: &containerinstance.ContainerState{
+								State:    to.StringPtr(containerStateTerminated),
+								ExitCode: to.Int32Ptr(0),
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	state := jobContainerState(containerGroup, "migrate")
+	if state == nil || *state.State != containerStateTerminated {
+		t.Fatalf("expected terminated state for migrate container")
+	}
+
+	if jobContainerState(containerGroup, "sidecar") != nil {
+		t.Errorf("expected nil state for container without instance view")
+	}
+
+	if jobContainerState(containerGroup, "missing") != nil {
+		t.Errorf("expected nil state for missing container")
+	}
+}
+
+func TestRunJobRejectsRegions(t *testing.T) {
+	_, err := RunJob(context.Background(), reconcileTestParams(), tc, &ContainerOptions{Regions: []string{"eastus", "westus2"}}, 0)
+	if err == nil || !strings.Contains(err.Error(), "failover regions are not supported") {
+		t.Errorf("expected regions to be rejected; got %v", err)
+	}
+}
@@ -0,0 +1,188 @@
+package azurewrapper
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	provide "github.com/provideplatform/provide-go/api/c2"
+)
+
+const defaultLifecyclePollInterval = time.Second * 5
+const defaultLifecycleTimeout = time.Minute * 10
+
+// ContainerGroupLifecycleOptions is a struct representing the params used to stop, start or restart a container group;
+// when `Wait` is true, the operation blocks until the group reaches the desired state or the timeout elapses
+type ContainerGroupLifecycleOptions struct {
+	Wait         bool
+	Timeout      time.Duration
+	PollInterval time.Duration
+}
+
+// ContainerGroupFailedError is returned when a container group is, or ends up, in a terminal failed state
+type ContainerGroupFailedError struct {
+	ContainerGroupName string
+	ProvisioningState  string
+	State              string
+}
+
+func (e *ContainerGroupFailedError) Error() string {
+	return fmt.Sprintf("container group %s is in a failed state; provisioning state: %s; state: %s", e.ContainerGroupName, e.ProvisioningState, e.State)
+}
+
+// StopContainerGroup stops all containers in the given container group
+func StopContainerGroup(ctx context.Context, tc *provide.TargetCredentials, resourceGroupName, containerGroupName string, opts *ContainerGroupLifecycleOptions) error {
+	ctx, cancel := lifecycleContext(ctx, opts)
+	defer cancel()
+
+	cgClient, err := NewContainerGroupsClient(tc)
+	if err != nil {
+		return fmt.Errorf("Unable to get container group client: %s; ", err.Error())
+	}
+
+	err = ensureContainerGroupNotFailed(ctx, tc, resourceGroupName, containerGroupName)
+	if err != nil {
+		return err
+	}
+
+	_, err = cgClient.Stop(ctx, resourceGroupName, containerGroupName)
+	if err != nil {
+		return fmt.Errorf("Unable to stop container group: %s; ", err.Error())
+	}
+
+	return waitForContainerGroupStatus(ctx, tc, resourceGroupName, containerGroupName, ContainerStatusStopped, opts)
+}
+
+// StartContainerGroup starts all containers in the given stopped container group
+func StartContainerGroup(ctx context.Context, tc *provide.TargetCredentials, resourceGroupName, containerGroupName string, opts *ContainerGroupLifecycleOptions) error {
+	ctx, cancel := lifecycleContext(ctx, opts)
+	defer cancel()
+
+	cgClient, err := NewContainerGroupsClient(tc)
+	if err != nil {
+		return fmt.Errorf("Unable to get container group client: %s; ", err.Error())
+	}
+
+	err = ensureContainerGroupNotFailed(ctx, tc, resourceGroupName, containerGroupName)
+	if err != nil {
+		return err
+	}
+
+	future, err := cgClient.Start(ctx, resourceGroupName, containerGroupName)
+	if err != nil {
+		return fmt.Errorf("Unable to start container group: %s; ", err.Error())
+	}
+
+	if opts != nil && opts.Wait {
+		err = future.WaitForCompletionRef(ctx, cgClient.Client)
+		if err != nil {
+			return fmt.Errorf("Unable to start container group: %s; ", err.Error())
+		}
+	}
+
+	return waitForContainerGroupStatus(ctx, tc, resourceGroupName, containerGroupName, ContainerStatusRunning, opts)
+}
+
+// RestartContainerGroup restarts all containers in the given container group in place
+func RestartContainerGroup(ctx context.Context, tc *provide.TargetCredentials, resourceGroupName, containerGroupName string, opts *ContainerGroupLifecycleOptions) error {
+	ctx, cancel := lifecycleContext(ctx, opts)
+	defer cancel()
+
+	cgClient, err := NewContainerGroupsClient(tc)
+	if err != nil {
+		return fmt.Errorf("Unable to get container group client: %s; ", err.Error())
+	}
+
+	err = ensureContainerGroupNotFailed(ctx, tc, resourceGroupName, containerGroupName)
+	if err != nil {
+		return err
+	}
+
+	future, err := cgClient.Restart(ctx, resourceGroupName, containerGroupName)
+	if err != nil {
+		return fmt.Errorf("Unable to restart container group: %s; ", err.Error())
+	}
+
+	if opts != nil && opts.Wait {
+		err = future.WaitForCompletionRef(ctx, cgClient.Client)
+		if err != nil {
+			return fmt.Errorf("Unable to restart container group: %s; ", err.Error())
+		}
+	}
+
+	return waitForContainerGroupStatus(ctx, tc, resourceGroupName, containerGroupName, ContainerStatusRunning, opts)
+}
+
+// lifecycleContext applies the configured timeout, if waiting, to the given context
+func lifecycleContext(ctx context.Context, opts *ContainerGroupLifecycleOptions) (context.Context, context.CancelFunc) {
+	if opts == nil || !opts.Wait {
+		return context.WithCancel(ctx)
+	}
+
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = defaultLifecycleTimeout
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// ensureContainerGroupNotFailed returns a ContainerGroupFailedError if the container group is in a terminal failed state
+func ensureContainerGroupNotFailed(ctx context.Context, tc *provide.TargetCredentials, resourceGroupName, containerGroupName string) error {
+	status, err := DescribeContainer(ctx, tc, resourceGroupName, containerGroupName)
+	if err != nil {
+		return err
+	}
+	return containerGroupFailure(status)
+}
+
+// containerGroupFailure returns a ContainerGroupFailedError if the given status is failed
+func containerGroupFailure(status *ContainerGroupStatus) error {
+	if status.Status != ContainerStatusFailed {
+		return nil
+	}
+	return &ContainerGroupFailedError{
+		ContainerGroupName: status.Name,
+		ProvisioningState:  status.ProvisioningState,
+		State:              status.State,
+	}
+}
+
+// waitForContainerGroupStatus polls the container group until it reaches the desired provider-neutral status;
+// it returns immediately unless waiting was requested
+func waitForContainerGroupStatus(ctx context.Context, tc *provide.TargetCredentials, resourceGroupName, containerGroupName, desired string, opts *ContainerGroupLifecycleOptions) error {
+	if opts == nil || !opts.Wait {
+		return nil
+	}
+
+	pollInterval := opts.PollInterval
+	if pollInterval <= 0 {
+		pollInterval = defaultLifecyclePollInterval
+	}
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	lastStatus := ContainerStatusUnknown
+	for {
+		status, err := DescribeContainer(ctx, tc, resourceGroupName, containerGroupName)
+		if err != nil && ctx.Err() == nil {
+			return err
+		}
+
+		if err == nil {
+			lastStatus = status.Status
+			if status.Status == desired {
+				return nil
+			}
+			if err := containerGroupFailure(status); err != nil {
+				return err
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("container group %s did not reach status %s; last status: %s; %s", containerGroupName, desired, lastStatus, ctx.Err().Error())
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package azurewrapper
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestContainerGroupFailure(t *testing.T) {
+	if err := containerGroupFailure(&ContainerGroupStatus{Name: "nats", Status: ContainerStatusRunning}); err != nil {
+		t.Errorf("expected no error for running container group")
+	}
+
+	err := containerGroupFailure(&ContainerGroupStatus{Name: "nats", Status: ContainerStatusFailed, ProvisioningState: "Failed"})
+	failedErr, ok := err.(*ContainerGroupFailedError)
+	if !ok {
+		t.Fatalf("expected container group failed error; got %T", err)
+	}
+	if failedErr.ContainerGroupName != "nats" || failedErr.ProvisioningState != "Failed" {
+		t.Errorf("expected failure details to be reported; got %+v", failedErr)
+	}
+}
+
+func TestLifecycleContext(t *testing.T) {
+	ctx, cancel := lifecycleContext(context.Background(), nil)
+	defer cancel()
+	if _, ok := ctx.Deadline(); ok {
+		t.Errorf("expected no deadline without waiting")
+	}
+
+	ctx, cancel = lifecycleContext(context.Background(), &ContainerGroupLifecycleOptions{Wait: true, Timeout: time.Minute})
+	defer cancel()
+	deadline, ok := ctx.Deadline()
+	if !ok || time.Until(deadline) > time.Minute {
+		t.Errorf("expected configured timeout to be applied")
+	}
+
+	if err := waitForContainerGroupStatus(context.Background(), tc, "skynet", "nats", ContainerStatusRunning, nil); err != nil {
+		t.Errorf("expected no wait without options")
+	}
+}
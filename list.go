@@ -0,0 +1,138 @@
+package azurewrapper
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/containerinstance/mgmt/2018-10-01/containerinstance"
+	"github.com/Azure/go-autorest/autorest/to"
+
+	provide "github.com/provideplatform/provide-go/api/c2"
+)
+
+// ContainerGroupFilter is a struct representing the criteria used to filter listed container groups;
+// all non-empty criteria must match
+type ContainerGroupFilter struct {
+	NamePrefix string
+	Regions    []string
+	Tags       map[string]string
+
+	// States matches either provider-neutral statuses (i.e., `running`) or Azure instance view states
+	States []string
+}
+
+// ListContainerGroups lists the container groups in the given resource group, or across the subscription when
+// no resource group is given, following pagination and applying the optional filter
+func ListContainerGroups(ctx context.Context, tc *provide.TargetCredentials, resourceGroupName string, filter *ContainerGroupFilter) ([]containerinstance.ContainerGroup, error) {
+	cgClient, err := NewContainerGroupsClient(tc)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get container group client: %s; ", err.Error())
+	}
+
+	var it containerinstance.ContainerGroupListResultIterator
+	if resourceGroupName == "" {
+		it, err = cgClient.ListComplete(ctx)
+	} else {
+		it, err = cgClient.ListByResourceGroupComplete(ctx, resourceGroupName)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Unable to list container groups: %s; ", err.Error())
+	}
+
+	containerGroups := make([]containerinstance.ContainerGroup, 0)
+	for it.NotDone() {
+		containerGroup := it.Value()
+		if matchesContainerGroupFilter(containerGroup, filter) {
+			containerGroups = append(containerGroups, containerGroup)
+		}
+
+		err = it.NextWithContext(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to list container groups: %s; ", err.Error())
+		}
+	}
+
+	if filter == nil || len(filter.States) == 0 {
+		return containerGroups, nil
+	}
+
+	// the list APIs do not include the instance view, so each candidate is fetched to match its state; candidates
+	// deleted since they were listed are skipped
+	filtered := make([]containerinstance.ContainerGroup, 0)
+	for _, containerGroup := range containerGroups {
+		detailed, err := cgClient.Get(ctx, containerGroupResourceGroupName(containerGroup), to.String(containerGroup.Name))
+		if isNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Unable to get container group: %s; ", err.Error())
+		}
+		if matchesContainerGroupState(detailed, filter.States) {
+			filtered = append(filtered, detailed)
+		}
+	}
+
+	return filtered, nil
+}
+
+// matchesContainerGroupFilter returns true if the container group matches the name, region and tag criteria of the filter
+func matchesContainerGroupFilter(containerGroup containerinstance.ContainerGroup, filter *ContainerGroupFilter) bool {
+	if filter == nil {
+		return true
+	}
+
+	if filter.NamePrefix != "" && !strings.HasPrefix(to.String(containerGroup.Name), filter.NamePrefix) {
+		return false
+	}
+
+	if len(filter.Regions) > 0 {
+		regionOk := false
+		for _, region := range filter.Regions {
+			if normalizeRegion(region) == normalizeRegion(to.String(containerGroup.Location)) {
+				regionOk = true
+				break
+			}
+		}
+		if !regionOk {
+			return false
+		}
+	}
+
+	for k, v := range filter.Tags {
+		tag, tagOk := containerGroup.Tags[k]
+		if !tagOk || tag == nil || *tag != v {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchesContainerGroupState returns true if the container group is in any of the given states
+func matchesContainerGroupState(containerGroup containerinstance.ContainerGroup, states []string) bool {
+	provisioningState, instanceState := containerGroupStates(containerGroup)
+	status := neutralContainerStatus(provisioningState, instanceState)
+	for _, state := range states {
+		if strings.EqualFold(state, status) || strings.EqualFold(state, instanceState) {
+			return true
+		}
+	}
+	return false
+}
+
+// containerGroupResourceGroupName parses the resource group name from the ID of the given container group
+func containerGroupResourceGroupName(containerGroup containerinstance.ContainerGroup) string {
+	return resourceIDSegment(to.String(containerGroup.ID), "resourceGroups")
+}
+
+// resourceIDSegment returns the segment of the given Azure resource ID which follows the given key
+func resourceIDSegment(resourceID, key string) string {
+	parts := strings.Split(resourceID, "/")
+	for i := 0; i < len(parts)-1; i++ {
+		if strings.EqualFold(parts[i], key) {
+			return parts[i+1]
+		}
+	}
+	return ""
+}
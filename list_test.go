@@ -0,0 +1,65 @@
+package azurewrapper
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/containerinstance/mgmt/2018-10-01/containerinstance"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+func TestMatchesContainerGroupFilter(t *testing.T) {
+	containerGroup := containerinstance.ContainerGroup{
+		ID:       to.StringPtr("/subscriptions/sub/resourceGroups/skynet/providers/Microsoft.ContainerInstance/containerGroups/nats-1"),
+		Name:     to.StringPtr("nats-1"),
+		Location: to.StringPtr("eastus"),
+		Tags: map[string]*string{
+			"network_id": to.StringPtr("abc"),
+			"owner":      to.StringPtr("ops"),
+		},
+	}
+
+	if !matchesContainerGroupFilter(containerGroup, nil) {
+		t.Errorf("expected nil filter to match")
+	}
+	if !matchesContainerGroupFilter(containerGroup, &ContainerGroupFilter{
+		NamePrefix: "nats-",
+		Regions:    []string{"westus", "East US"},
+		Tags:       map[string]string{"network_id": "abc"},
+	}) {
+		t.Errorf("expected filter to match")
+	}
+	if matchesContainerGroupFilter(containerGroup, &ContainerGroupFilter{NamePrefix: "geth-"}) {
+		t.Errorf("expected name prefix mismatch")
+	}
+	if matchesContainerGroupFilter(containerGroup, &ContainerGroupFilter{Regions: []string{"westeurope"}}) {
+		t.Errorf("expected region mismatch")
+	}
+	if matchesContainerGroupFilter(containerGroup, &ContainerGroupFilter{Tags: map[string]string{"owner": "dev"}}) {
+		t.Errorf("expected tag mismatch")
+	}
+
+	if name := containerGroupResourceGroupName(containerGroup); name != "skynet" {
+		t.Errorf("expected resource group skynet; got %s", name)
+	}
+}
+
+func TestMatchesContainerGroupState(t *testing.T) {
+	containerGroup := containerinstance.ContainerGroup{
+		ContainerGroupProperties: &containerinstance.ContainerGroupProperties{
+			ProvisioningState: to.StringPtr("Succeeded"),
+			InstanceView: &containerinstance.ContainerGroupPropertiesInstanceView{
+				State: to.StringPtr("Stopped"),
+			},
+		},
+	}
+
+	if !matchesContainerGroupState(containerGroup, []string{ContainerStatusStopped}) {
+		t.Errorf("expected neutral state to match")
+	}
+	if !matchesContainerGroupState(containerGroup, []string{"Stopped"}) {
+		t.Errorf("expected instance view state to match")
+	}
+	if matchesContainerGroupState(containerGroup, []string{ContainerStatusRunning}) {
+		t.Errorf("expected running state not to match")
+	}
+}
@@ -0,0 +1,222 @@
+package azurewrapper
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest/to"
+
+	provide "github.com/provideplatform/provide-go/api/c2"
+)
+
+const defaultLogStreamPollInterval = time.Second * 2
+const defaultLogStreamTail = int32(1000)
+
+// ContainerLogLine represents a single line of container output emitted by StreamContainerLogs; ACI does not
+// record when a line was written, so Timestamp is the time of the poll which first observed the line and lines
+// observed by the same poll share a timestamp
+type ContainerLogLine struct {
+	ContainerName string
+	Timestamp     *time.Time
+	Line          string
+}
+
+// String formats the log line, prefixing the container name and timestamp when present
+func (l *ContainerLogLine) String() string {
+	if l.Timestamp != nil {
+		return fmt.Sprintf("[%s] %s %s", l.ContainerName, l.Timestamp.Format(time.RFC3339Nano), l.Line)
+	}
+	return fmt.Sprintf("[%s] %s", l.ContainerName, l.Line)
+}
+
+// ContainerLogStreamOptions is a struct representing the params used to follow container logs;
+// when no container names are given, the logs of every container in the group are multiplexed.
+// Tail limits the lines emitted from the logs which exist when the stream starts
+type ContainerLogStreamOptions struct {
+	ContainerNames []string
+	PollInterval   time.Duration
+	Tail           *int32
+	Timestamps     bool
+}
+
+// StreamContainerLogs follows the logs of the containers in the given container group, emitting new lines
+// until the context is cancelled; each poll retrieves the complete logs and emits the lines following those
+// already seen. A container restart resets its logs, in which case every line is emitted again; logs which ACI
+// truncates from the start may be missed. Polling errors are delivered on the error channel without interrupting
+// the stream
+func StreamContainerLogs(ctx context.Context, tc *provide.TargetCredentials, resourceGroupName, containerGroupName string, opts *ContainerLogStreamOptions) (<-chan *ContainerLogLine, <-chan error, error) {
+	if opts == nil {
+		opts = &ContainerLogStreamOptions{}
+	}
+
+	pollInterval := opts.PollInterval
+	if pollInterval <= 0 {
+		pollInterval = defaultLogStreamPollInterval
+	}
+
+	tail := to.Int32Ptr(defaultLogStreamTail)
+	if opts.Tail != nil {
+		tail = opts.Tail
+	}
+
+	containerNames := opts.ContainerNames
+	if len(containerNames) == 0 {
+		containerGroup, err := GetContainerGroup(ctx, tc, resourceGroupName, containerGroupName)
+		if err != nil {
+			return nil, nil, err
+		}
+		if containerGroup.ContainerGroupProperties != nil && containerGroup.Containers != nil {
+			for _, container := range *containerGroup.Containers {
+				containerNames = append(containerNames, to.String(container.Name))
+			}
+		}
+	}
+	if len(containerNames) == 0 {
+		return nil, nil, fmt.Errorf("Unable to stream container logs: no containers in container group %s; ", containerGroupName)
+	}
+
+	cClient, err := NewContainerClient(tc)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Unable to get container client: %s; ", err.Error())
+	}
+
+	lines := make(chan *ContainerLogLine)
+	errs := make(chan error, len(containerNames))
+
+	var wg sync.WaitGroup
+	for _, containerName := range containerNames {
+		wg.Add(1)
+		go func(containerName string) {
+			defer wg.Done()
+
+			offset := -1
+			ticker := time.NewTicker(pollInterval)
+			defer ticker.Stop()
+
+			for {
+				logs, err := listContainerLogs(ctx, cClient, resourceGroupName, containerGroupName, containerName, nil)
+				if err != nil && ctx.Err() == nil {
+					select {
+					case errs <- fmt.Errorf("Unable to get container logs for %s: %s; ", containerName, err.Error()):
+					default:
+						log.Debugf("dropped container log stream error for %s; %s", containerName, err.Error())
+					}
+				} else if err == nil {
+					var newLines []string
+					newLines, offset = newLogLines(offset, splitLogLines(to.String(logs.Content)), int(*tail))
+					observedAt := time.Now()
+					for _, line := range newLines {
+						logLine := &ContainerLogLine{
+							ContainerName: containerName,
+							Line:          line,
+						}
+						if opts.Timestamps {
+							logLine.Timestamp = &observedAt
+						}
+						select {
+						case lines <- logLine:
+						case <-ctx.Done():
+							return
+						}
+					}
+				}
+
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}(containerName)
+	}
+
+	go func() {
+		wg.Wait()
+		close(lines)
+		close(errs)
+	}()
+
+	return lines, errs, nil
+}
+
+// ContainerLogReader follows the logs of the given container group and exposes the formatted lines as an io.ReadCloser;
+// closing the reader stops the stream
+func ContainerLogReader(ctx context.Context, tc *provide.TargetCredentials, resourceGroupName, containerGroupName string, opts *ContainerLogStreamOptions) (io.ReadCloser, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	lines, errs, err := StreamContainerLogs(ctx, tc, resourceGroupName, containerGroupName, opts)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	singleContainer := opts != nil && len(opts.ContainerNames) == 1
+	reader, writer := io.Pipe()
+	go func() {
+		defer cancel()
+		for {
+			select {
+			case line, ok := <-lines:
+				if !ok {
+					writer.Close()
+					return
+				}
+				formatted := line.String()
+				if singleContainer && line.Timestamp == nil {
+					formatted = line.Line
+				}
+				if _, err := io.WriteString(writer, formatted+"\n"); err != nil {
+					return
+				}
+			case err, ok := <-errs:
+				if ok {
+					log.Warningf("%s", err.Error())
+				} else {
+					errs = nil
+				}
+			}
+		}
+	}()
+
+	return &logStreamReader{PipeReader: reader, cancel: cancel}, nil
+}
+
+type logStreamReader struct {
+	*io.PipeReader
+	cancel context.CancelFunc
+}
+
+func (r *logStreamReader) Close() error {
+	r.cancel()
+	return r.PipeReader.Close()
+}
+
+// splitLogLines splits raw container logs into lines, dropping the trailing newline
+func splitLogLines(content string) []string {
+	content = strings.TrimRight(content, "\n")
+	if content == "" {
+		return []string{}
+	}
+	return strings.Split(content, "\n")
+}
+
+// newLogLines returns the lines of the logs which follow the given offset, along with the offset of the next poll;
+// a negative offset marks the first poll, which returns at most tail lines, and logs shorter than the offset
+// have been reset by a container restart, so every line is new
+func newLogLines(offset int, logs []string, tail int) ([]string, int) {
+	start := offset
+	if offset < 0 {
+		start = len(logs) - tail
+		if start < 0 {
+			start = 0
+		} else if start > len(logs) {
+			start = len(logs)
+		}
+	} else if len(logs) < offset {
+		start = 0
+	}
+	return logs[start:], len(logs)
+}
@@ -0,0 +1,42 @@
+package azurewrapper
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewLogLines(t *testing.T) {
+	cases := []struct {
+		offset         int
+		logs           []string
+		tail           int
+		expected       []string
+		expectedOffset int
+	}{
+		{-1, []string{}, 10, []string{}, 0},
+		{-1, []string{"a", "b", "c"}, 10, []string{"a", "b", "c"}, 3},
+		{-1, []string{"a", "b", "c"}, 2, []string{"b", "c"}, 3},
+		{-1, []string{"a", "b"}, 0, []string{}, 2},
+		{2, []string{"a", "b"}, 10, []string{}, 2},
+		{2, []string{"a", "b", "c"}, 10, []string{"c"}, 3},
+		{2, []string{"a", "a", "a"}, 10, []string{"a"}, 3},
+		{2, []string{"b", "a", "b"}, 10, []string{"b"}, 3},
+		{3, []string{"x", "y"}, 10, []string{"x", "y"}, 2},
+	}
+
+	for _, c := range cases {
+		lines, offset := newLogLines(c.offset, c.logs, c.tail)
+		if !reflect.DeepEqual(lines, c.expected) || offset != c.expectedOffset {
+			t.Errorf("expected %v at offset %d for %v from offset %d; got %v at offset %d", c.expected, c.expectedOffset, c.logs, c.offset, lines, offset)
+		}
+	}
+}
+
+func TestSplitLogLines(t *testing.T) {
+	if lines := splitLogLines(""); len(lines) != 0 {
+		t.Errorf("expected no lines for empty logs")
+	}
+	if lines := splitLogLines("a\nb\n"); !reflect.DeepEqual(lines, []string{"a", "b"}) {
+		t.Errorf("expected trailing newline to be dropped; got %v", lines)
+	}
+}
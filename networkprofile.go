@@ -0,0 +1,219 @@
+package azurewrapper
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-12-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+
+	provide "github.com/provideplatform/provide-go/api/c2"
+)
+
+// NewProfilesClient initializes and returns an instance of the Azure network profiles API client
+func NewProfilesClient(tc *provide.TargetCredentials) (network.ProfilesClient, error) {
+	client := network.NewProfilesClient(*tc.AzureSubscriptionID)
+	if auth, err := GetAuthorizer(tc); err == nil {
+		client.Authorizer = *auth
+		return client, nil
+	} else {
+		return client, err
+	}
+}
+
+// containerGroupSubnetID returns the ID of the subnet given in the options into which the container group is
+// deployed, or an empty string when the container group is exposed using a public IP address
+func containerGroupSubnetID(opts *ContainerOptions) (string, error) {
+	if opts == nil || opts.SubnetID == "" {
+		return "", nil
+	}
+
+	subnetID := opts.SubnetID
+	if resourceIDSegment(subnetID, "resourceGroups") == "" || resourceIDSegment(subnetID, "virtualNetworks") == "" || resourceIDSegment(subnetID, "subnets") == "" {
+		return "", fmt.Errorf("invalid subnet ID: %s", subnetID)
+	}
+	return subnetID, nil
+}
+
+// subnetNetworkProfileName returns the name of the network profile managed for the given subnet
+func subnetNetworkProfileName(virtualNetworkName, subnetName string) string {
+	return fmt.Sprintf("%s-%s-profile", virtualNetworkName, subnetName)
+}
+
+// subnetNetworkProfileID returns the ARM resource ID of the network profile managed for the subnet with the given ID
+func subnetNetworkProfileID(tc *provide.TargetCredentials, subnetID string) string {
+	groupName := resourceIDSegment(subnetID, "resourceGroups")
+	name := subnetNetworkProfileName(resourceIDSegment(subnetID, "virtualNetworks"), resourceIDSegment(subnetID, "subnets"))
+	return fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/networkProfiles/%s", *tc.AzureSubscriptionID, groupName, name)
+}
+
+// prepareContainerGroupSubnet enforces the security policy of the container params on the subnet into which the
+// container group is deployed and upserts the network profile through which it is attached to the subnet. The
+// security policy applies to every container group in the subnet, so a SecurityPolicyConflictError is returned
+// rather than changing the rules while other container groups remain in the subnet. Nothing is done when no
+// subnet is given in the options
+func prepareContainerGroupSubnet(ctx context.Context, tc *provide.TargetCredentials, cp *provide.ContainerParams, opts *ContainerOptions) error {
+	subnetID, err := containerGroupSubnetID(opts)
+	if err != nil {
+		return fmt.Errorf("Unable to start container in region: %s; %s", cp.Region, err.Error())
+	}
+	if subnetID == "" {
+		return nil
+	}
+
+	policy, err := containerSecurityPolicy(cp, opts)
+	if err != nil {
+		return fmt.Errorf("Unable to start container in region: %s; %s", cp.Region, err.Error())
+	}
+
+	var tags map[string]string
+	if opts != nil {
+		tags = opts.Tags
+	}
+
+	groupName := resourceIDSegment(subnetID, "resourceGroups")
+	virtualNetworkName := resourceIDSegment(subnetID, "virtualNetworks")
+	subnetName := resourceIDSegment(subnetID, "subnets")
+
+	err = checkSubnetSecurityPolicyConflict(ctx, tc, cp, subnetID, policy)
+	if err != nil {
+		return err
+	}
+
+	_, err = EnforceSecurityPolicy(ctx, tc, groupName, cp.Region, virtualNetworkName, subnetName, policy, tags)
+	if err != nil {
+		return err
+	}
+
+	_, err = upsertSubnetNetworkProfile(ctx, tc, subnetID, cp.Region, tags)
+	return err
+}
+
+// upsertSubnetNetworkProfile creates or updates the network profile through which container groups are attached
+// to the subnet with the given ID
+func upsertSubnetNetworkProfile(ctx context.Context, tc *provide.TargetCredentials, subnetID, region string, tags map[string]string) (*network.Profile, error) {
+	profileTags, err := resourceTags(tags)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create network profile: %v", err)
+	}
+
+	profileClient, err := NewProfilesClient(tc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create network profile client; %s", err.Error())
+	}
+
+	groupName := resourceIDSegment(subnetID, "resourceGroups")
+	name := subnetNetworkProfileName(resourceIDSegment(subnetID, "virtualNetworks"), resourceIDSegment(subnetID, "subnets"))
+
+	existing, err := profileClient.Get(ctx, groupName, name, "")
+	if err != nil && !isNotFound(err) {
+		return nil, fmt.Errorf("failed to get network profile %s; %s", name, err.Error())
+	}
+	profileTags, err = upsertedResourceTags(profileTags, existing.Tags, err == nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create network profile: %v", err)
+	}
+
+	profile, err := profileClient.CreateOrUpdate(ctx, groupName, name, network.Profile{
+		Location: to.StringPtr(region),
+		Tags:     profileTags,
+		ProfilePropertiesFormat: &network.ProfilePropertiesFormat{
+			ContainerNetworkInterfaceConfigurations: &[]network.ContainerNetworkInterfaceConfiguration{
+				{
+					Name: to.StringPtr("eth0"),
+					ContainerNetworkInterfaceConfigurationPropertiesFormat: &network.ContainerNetworkInterfaceConfigurationPropertiesFormat{
+						IPConfigurations: &[]network.IPConfigurationProfile{
+							{
+								Name: to.StringPtr("ipconfig"),
+								IPConfigurationProfilePropertiesFormat: &network.IPConfigurationProfilePropertiesFormat{
+									Subnet: &network.Subnet{ID: to.StringPtr(subnetID)},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot create network profile: %v", err)
+	}
+
+	return &profile, nil
+}
+
+// checkSubnetSecurityPolicyConflict returns a SecurityPolicyConflictError if the security policy differs from the
+// rules of the network security group managed for the subnet while container groups other than the one described
+// by the given params are attached to the subnet
+func checkSubnetSecurityPolicyConflict(ctx context.Context, tc *provide.TargetCredentials, cp *provide.ContainerParams, subnetID string, policy *SecurityPolicy) error {
+	rules, err := securityPolicyRules(policy)
+	if err != nil {
+		return fmt.Errorf("Unable to start container in region: %s; %s", cp.Region, err.Error())
+	}
+
+	groupName := resourceIDSegment(subnetID, "resourceGroups")
+	virtualNetworkName := resourceIDSegment(subnetID, "virtualNetworks")
+	subnetName := resourceIDSegment(subnetID, "subnets")
+
+	nsg, err := getSecurityGroup(ctx, tc, groupName, subnetSecurityGroupName(virtualNetworkName, subnetName))
+	if err != nil {
+		return err
+	}
+	if nsg == nil || securityRulesEqual(nsg, rules) {
+		return nil
+	}
+
+	profileClient, err := NewProfilesClient(tc)
+	if err != nil {
+		return fmt.Errorf("failed to create network profile client; %s", err.Error())
+	}
+
+	profile, err := profileClient.Get(ctx, groupName, subnetNetworkProfileName(virtualNetworkName, subnetName), "")
+	if err != nil {
+		if isNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to get network profile of subnet %s; %s", subnetName, err.Error())
+	}
+
+	containerGroupID := containerGroupResourceID(tc, cp.ResourceGroupName, *cp.ContainerGroupName)
+	others := make([]string, 0)
+	for _, id := range networkProfileContainerGroupIDs(profile) {
+		if !strings.EqualFold(id, containerGroupID) {
+			others = append(others, id)
+		}
+	}
+	if len(others) > 0 {
+		return &SecurityPolicyConflictError{
+			SecurityGroupID:   to.String(nsg.ID),
+			ContainerGroupIDs: others,
+		}
+	}
+
+	return nil
+}
+
+// networkProfileContainerGroupIDs returns the IDs of the container groups attached through the given network profile
+func networkProfileContainerGroupIDs(profile network.Profile) []string {
+	ids := make([]string, 0)
+	if profile.ProfilePropertiesFormat == nil || profile.ContainerNetworkInterfaces == nil {
+		return ids
+	}
+
+	seen := map[string]bool{}
+	for _, nic := range *profile.ContainerNetworkInterfaces {
+		if nic.ContainerNetworkInterfacePropertiesFormat == nil || nic.Container == nil {
+			continue
+		}
+		id := to.String(nic.Container.ID)
+		if i := strings.LastIndex(strings.ToLower(id), "/containers/"); i != -1 {
+			id = id[:i]
+		}
+		if id != "" && !seen[strings.ToLower(id)] {
+			seen[strings.ToLower(id)] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,46 @@
+package azurewrapper
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-12-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+func TestContainerGroupSubnetID(t *testing.T) {
+	subnetID := "/subscriptions/sub/resourceGroups/network/providers/Microsoft.Network/virtualNetworks/vnet/subnets/containers"
+
+	if id, err := containerGroupSubnetID(nil); err != nil || id != "" {
+		t.Errorf("expected no subnet without options")
+	}
+	if id, err := containerGroupSubnetID(&ContainerOptions{}); err != nil || id != "" {
+		t.Errorf("expected no subnet without subnet ID")
+	}
+	if id, err := containerGroupSubnetID(&ContainerOptions{SubnetID: subnetID}); err != nil || id != subnetID {
+		t.Errorf("expected subnet ID to be returned; got %s", id)
+	}
+	if _, err := containerGroupSubnetID(&ContainerOptions{SubnetID: "containers"}); err == nil {
+		t.Errorf("expected invalid subnet ID to be rejected")
+	}
+}
+
+func TestNetworkProfileContainerGroupIDs(t *testing.T) {
+	containerGroupID := "/subscriptions/sub/resourceGroups/containers/providers/Microsoft.ContainerInstance/containerGroups/nats"
+	profile := network.Profile{
+		ProfilePropertiesFormat: &network.ProfilePropertiesFormat{
+			ContainerNetworkInterfaces: &[]network.ContainerNetworkInterface{
+				{ContainerNetworkInterfacePropertiesFormat: &network.ContainerNetworkInterfacePropertiesFormat{Container: &network.Container{ID: to.StringPtr(containerGroupID + "/containers/nats")}}},
+				{ContainerNetworkInterfacePropertiesFormat: &network.ContainerNetworkInterfacePropertiesFormat{Container: &network.Container{ID: to.StringPtr(containerGroupID + "/containers/sidecar")}}},
+				{ContainerNetworkInterfacePropertiesFormat: &network.ContainerNetworkInterfacePropertiesFormat{}},
+			},
+		},
+	}
+
+	ids := networkProfileContainerGroupIDs(profile)
+	if len(ids) != 1 || ids[0] != containerGroupID {
+		t.Errorf("expected the container group of each attached container once; got %v", ids)
+	}
+	if len(networkProfileContainerGroupIDs(network.Profile{})) != 0 {
+		t.Errorf("expected no container groups without network interfaces")
+	}
+}
@@ -0,0 +1,155 @@
+package azurewrapper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/containerinstance/mgmt/2018-10-01/containerinstance"
+
+	provide "github.com/provideplatform/provide-go/api/c2"
+)
+
+// ContainerOperation is a serializable handle to an in-flight container group deployment which
+// can be resumed or polled from any process with access to the same credentials
+type ContainerOperation struct {
+	ResourceGroupName  string          `json:"resource_group_name"`
+	ContainerGroupName string          `json:"container_group_name"`
+	Region             string          `json:"region"`
+	PollingURL         string          `json:"polling_url"`
+	PollingMethod      string          `json:"polling_method"`
+	Future             json.RawMessage `json:"future"`
+	StartedAt          time.Time       `json:"started_at"`
+}
+
+// Marshal returns the JSON representation of the operation handle
+func (o *ContainerOperation) Marshal() ([]byte, error) {
+	return json.Marshal(o)
+}
+
+// UnmarshalContainerOperation parses an operation handle previously returned by ContainerOperation.Marshal
+func UnmarshalContainerOperation(raw []byte) (*ContainerOperation, error) {
+	var op ContainerOperation
+	err := json.Unmarshal(raw, &op)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal container operation; %s", err.Error())
+	}
+	if len(op.Future) == 0 {
+		return nil, fmt.Errorf("failed to unmarshal container operation; missing future")
+	}
+	return &op, nil
+}
+
+// future rehydrates the container group create or update future from the operation handle
+func (o *ContainerOperation) future() (*containerinstance.ContainerGroupsCreateOrUpdateFuture, error) {
+	var future containerinstance.ContainerGroupsCreateOrUpdateFuture
+	err := json.Unmarshal(o.Future, &future)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resume container operation for container group %s; %s", o.ContainerGroupName, err.Error())
+	}
+	return &future, nil
+}
+
+// StartContainerAsync submits the container group deployment and returns a resumable operation handle
+// without waiting for the deployment to complete; failing over to other regions requires waiting for the
+// deployment, so regions given in the options are rejected
+func StartContainerAsync(ctx context.Context, cp *provide.ContainerParams, tc *provide.TargetCredentials, opts *ContainerOptions) (*ContainerOperation, error) {
+	if opts != nil && len(opts.Regions) > 0 {
+		return nil, fmt.Errorf("Unable to start container in region: %s; failover regions are not supported for asynchronous deployments; use SelectContainerRegion", cp.Region)
+	}
+
+	loadContainerRegionResourceLimits(ctx, tc, cp)
+	containerGroupParams, err := containerGroupFromParams(cp, tc, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	err = preflightContainerGroupIfRequested(ctx, tc, cp, *containerGroupParams, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	cgClient, err := NewContainerGroupsClient(tc)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get container group client: %s; ", err.Error())
+	}
+
+	err = prepareContainerGroupSubnet(ctx, tc, cp, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	future, err := createOrUpdateContainerGroup(ctx, cgClient, cp.ResourceGroupName, *cp.ContainerGroupName, *containerGroupParams, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create container group; %s", err.Error())
+	}
+
+	raw, err := json.Marshal(future)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal container group future; %s", err.Error())
+	}
+
+	return &ContainerOperation{
+		ResourceGroupName:  cp.ResourceGroupName,
+		ContainerGroupName: *cp.ContainerGroupName,
+		Region:             cp.Region,
+		PollingURL:         future.PollingURL(),
+		PollingMethod:      string(future.PollingMethod()),
+		Future:             raw,
+		StartedAt:          time.Now(),
+	}, nil
+}
+
+// PollOperation checks the operation once, returning the container create result when the deployment has completed
+func PollOperation(ctx context.Context, tc *provide.TargetCredentials, op *ContainerOperation) (done bool, result *provide.ContainerCreateResult, err error) {
+	future, err := op.future()
+	if err != nil {
+		return false, nil, err
+	}
+
+	cgClient, err := NewContainerGroupsClient(tc)
+	if err != nil {
+		return false, nil, fmt.Errorf("Unable to get container group client: %s; ", err.Error())
+	}
+
+	done, err = future.DoneWithContext(ctx, cgClient)
+	if err != nil {
+		return false, nil, fmt.Errorf("failed to poll container group %s; %s", op.ContainerGroupName, err.Error())
+	}
+	if !done {
+		return false, nil, nil
+	}
+
+	containerGroup, err := future.Result(cgClient)
+	if err != nil {
+		return true, nil, fmt.Errorf("failed to create container group %s; %s", op.ContainerGroupName, err.Error())
+	}
+
+	return true, containerCreateResult(containerGroup), nil
+}
+
+// ResumeOperation waits for the operation to complete and returns the container create result
+func ResumeOperation(ctx context.Context, tc *provide.TargetCredentials, op *ContainerOperation) (*provide.ContainerCreateResult, error) {
+	future, err := op.future()
+	if err != nil {
+		return nil, err
+	}
+
+	cgClient, err := NewContainerGroupsClient(tc)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get container group client: %s; ", err.Error())
+	}
+
+	err = future.WaitForCompletionRef(ctx, cgClient.Client)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create container group %s; %s", op.ContainerGroupName, err.Error())
+	}
+
+	containerGroup, err := future.Result(cgClient)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create container group %s; %s", op.ContainerGroupName, err.Error())
+	}
+
+	return containerCreateResult(containerGroup), nil
+}
@@ -0,0 +1,68 @@
+package azurewrapper
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/containerinstance/mgmt/2018-10-01/containerinstance"
+	"github.com/Azure/go-autorest/autorest/azure"
+)
+
+func TestContainerOperationRoundTrip(t *testing.T) {
+	pollingURL := "https://management.azure.com/subscriptions/sub/providers/Microsoft.ContainerInstance/locations/eastus/operations/op?api-version=2018-10-01"
+	req, _ := http.NewRequest(http.MethodPut, "https://management.azure.com/subscriptions/sub/resourceGroups/skynet/providers/Microsoft.ContainerInstance/containerGroups/node?api-version=2018-10-01", nil)
+	resp := &http.Response{
+		StatusCode: http.StatusCreated,
+		Header:     http.Header{},
+		Request:    req,
+	}
+	resp.Header.Set("Azure-AsyncOperation", pollingURL)
+
+	f, err := azure.NewFutureFromResponse(resp)
+	if err != nil {
+		t.Fatalf("failed to init future; %s", err.Error())
+	}
+	raw, _ := json.Marshal(containerinstance.ContainerGroupsCreateOrUpdateFuture{Future: f})
+
+	op := &ContainerOperation{
+		ResourceGroupName:  "skynet",
+		ContainerGroupName: "node",
+		Region:             "eastus",
+		PollingURL:         f.PollingURL(),
+		Future:             raw,
+	}
+	data, err := op.Marshal()
+	if err != nil {
+		t.Fatalf("failed to marshal container operation; %s", err.Error())
+	}
+
+	resumed, err := UnmarshalContainerOperation(data)
+	if err != nil {
+		t.Fatalf("failed to unmarshal container operation; %s", err.Error())
+	}
+	if resumed.ContainerGroupName != "node" || resumed.PollingURL != pollingURL {
+		t.Errorf("expected operation metadata to survive round trip; got %+v", resumed)
+	}
+
+	future, err := resumed.future()
+	if err != nil {
+		t.Fatalf("failed to rehydrate future; %s", err.Error())
+	}
+	if future.PollingURL() != pollingURL {
+		t.Errorf("expected rehydrated future polling url %s; got %s", pollingURL, future.PollingURL())
+	}
+
+	if _, err := UnmarshalContainerOperation([]byte(`{"container_group_name":"node"}`)); err == nil {
+		t.Errorf("expected error for operation without future")
+	}
+}
+
+func TestStartContainerAsyncRejectsRegions(t *testing.T) {
+	_, err := StartContainerAsync(context.Background(), reconcileTestParams(), tc, &ContainerOptions{Regions: []string{"eastus", "westus2"}})
+	if err == nil || !strings.Contains(err.Error(), "failover regions are not supported") {
+		t.Errorf("expected regions to be rejected; got %v", err)
+	}
+}
@@ -0,0 +1,233 @@
+package azurewrapper
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/azure"
+	"github.com/Azure/go-autorest/autorest/to"
+
+	provide "github.com/provideplatform/provide-go/api/c2"
+)
+
+// ContainerPlacementAttempt is the outcome of placing a container group in a single region
+type ContainerPlacementAttempt struct {
+	Region string
+	Err    error
+}
+
+// ContainerPlacementError is returned when a container group cannot be placed in any of the given regions
+type ContainerPlacementError struct {
+	Attempts []ContainerPlacementAttempt
+}
+
+func (e *ContainerPlacementError) Error() string {
+	attempts := make([]string, 0, len(e.Attempts))
+	for _, attempt := range e.Attempts {
+		attempts = append(attempts, fmt.Sprintf("%s: %s", attempt.Region, attempt.Err.Error()))
+	}
+	return fmt.Sprintf("container group cannot be placed in any region; %s", strings.Join(attempts, "; "))
+}
+
+// SelectContainerRegion returns the first of the given ranked regions with enough quota and capability for the
+// container group described by the given params, or a ContainerPlacementError describing why each region was rejected
+func SelectContainerRegion(ctx context.Context, cp *provide.ContainerParams, tc *provide.TargetCredentials, opts *ContainerOptions, regions []string) (string, error) {
+	placementErr := &ContainerPlacementError{
+		Attempts: make([]ContainerPlacementAttempt, 0),
+	}
+
+	for _, region := range regions {
+		err := preflightContainerRegion(ctx, cp, tc, opts, region)
+		if err == nil {
+			return region, nil
+		}
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		placementErr.Attempts = append(placementErr.Attempts, ContainerPlacementAttempt{Region: region, Err: err})
+	}
+
+	if len(placementErr.Attempts) == 0 {
+		return "", fmt.Errorf("Unable to select container region; no regions given")
+	}
+	return "", placementErr
+}
+
+// preflightContainerRegion runs the preflight for the container group described by the given params in the given region
+func preflightContainerRegion(ctx context.Context, cp *provide.ContainerParams, tc *provide.TargetCredentials, opts *ContainerOptions, region string) error {
+	regionParams := *cp
+	regionParams.Region = region
+	return PreflightContainer(ctx, &regionParams, tc, opts)
+}
+
+// ContainerPlacementResult is the outcome of starting a container group in the first suitable of the ranked
+// regions given in the options
+type ContainerPlacementResult struct {
+	Region string
+	Result *provide.ContainerCreateResult
+}
+
+// containerPlacer deploys a container group into a single region
+type containerPlacer interface {
+	preflight(ctx context.Context, region string) error
+	start(ctx context.Context, region string) (*provide.ContainerCreateResult, bool, error)
+	cleanup() error
+}
+
+// azureContainerPlacer deploys the container group described by the given params using the Azure API
+type azureContainerPlacer struct {
+	cp   *provide.ContainerParams
+	tc   *provide.TargetCredentials
+	opts *ContainerOptions
+}
+
+func (p *azureContainerPlacer) regionParams(region string) *provide.ContainerParams {
+	regionParams := *p.cp
+	regionParams.Region = region
+	return &regionParams
+}
+
+func (p *azureContainerPlacer) preflight(ctx context.Context, region string) error {
+	return PreflightContainer(ctx, p.regionParams(region), p.tc, p.opts)
+}
+
+func (p *azureContainerPlacer) start(ctx context.Context, region string) (*provide.ContainerCreateResult, bool, error) {
+	return startContainer(ctx, p.regionParams(region), p.tc, p.opts)
+}
+
+func (p *azureContainerPlacer) cleanup() error {
+	return cleanupContainerGroup(p.tc, p.cp.ResourceGroupName, *p.cp.ContainerGroupName)
+}
+
+// startContainerWithFailover starts the container group in the first of the ranked regions given in the options which
+// passes the preflight, failing over to the next region if the deployment fails there. A container group which
+// already exists is only ever updated in place in its own region, and is never deleted. The region in which the
+// container group was started is returned
+func startContainerWithFailover(ctx context.Context, cp *provide.ContainerParams, tc *provide.TargetCredentials, opts *ContainerOptions) (*provide.ContainerCreateResult, string, bool, error) {
+	if opts.SubnetID != "" && len(opts.Regions) > 1 {
+		return nil, "", false, fmt.Errorf("Unable to start container in region: %s; container groups deployed into subnet %s cannot fail over to other regions", cp.Region, opts.SubnetID)
+	}
+
+	regionOpts := *opts
+	regionOpts.Regions = nil
+	regionOpts.Preflight = false
+
+	// invalid params fail in every region, so they are rejected before any region is attempted
+	regionParams := *cp
+	regionParams.Region = opts.Regions[0]
+	_, err := containerGroupFromParams(&regionParams, tc, &regionOpts)
+	if err != nil && !isRegionalPlacementError(err) {
+		return nil, "", false, err
+	}
+
+	cgClient, err := NewContainerGroupsClient(tc)
+	if err != nil {
+		return nil, "", false, fmt.Errorf("Unable to get container group client: %s; ", err.Error())
+	}
+
+	regions := opts.Regions
+	existed := false
+	existing, err := cgClient.Get(ctx, cp.ResourceGroupName, *cp.ContainerGroupName)
+	if err != nil && !isNotFound(err) {
+		return nil, "", false, fmt.Errorf("Unable to get container group: %s; ", err.Error())
+	}
+	if err == nil {
+		existed = true
+		regions, err = existingContainerGroupRegions(*cp.ContainerGroupName, to.String(existing.Location), opts.Regions)
+		if err != nil {
+			return nil, "", false, err
+		}
+	}
+
+	placer := &azureContainerPlacer{cp: cp, tc: tc, opts: &regionOpts}
+	return placeContainerGroup(ctx, placer, *cp.ContainerGroupName, regions, existed)
+}
+
+// existingContainerGroupRegions returns the region of the existing container group when it is among the given
+// regions, since Azure rejects moving a container group to another region
+func existingContainerGroupRegions(containerGroupName, location string, regions []string) ([]string, error) {
+	for _, region := range regions {
+		if normalizeRegion(region) == normalizeRegion(location) {
+			return []string{region}, nil
+		}
+	}
+	return nil, fmt.Errorf("container group %s already exists in region %s; it cannot be moved to any of the regions: %v", containerGroupName, location, regions)
+}
+
+// placeContainerGroup attempts the given regions in order, failing over to the next region only when the attempt
+// failed for reasons specific to the region; a failed container group is deleted before failing over, since
+// container group names are unique within the resource group, but only when it was created by this attempt
+func placeContainerGroup(ctx context.Context, placer containerPlacer, containerGroupName string, regions []string, existed bool) (*provide.ContainerCreateResult, string, bool, error) {
+	placementErr := &ContainerPlacementError{
+		Attempts: make([]ContainerPlacementAttempt, 0),
+	}
+
+	for _, region := range regions {
+		err := placer.preflight(ctx, region)
+		if err != nil && !isRegionalPlacementError(err) {
+			return nil, "", false, err
+		}
+
+		if err == nil {
+			var result *provide.ContainerCreateResult
+			var submitted bool
+			result, submitted, err = placer.start(ctx, region)
+			if err == nil {
+				return result, region, true, nil
+			}
+			if _, cancelled := err.(*ContainerStartCancelledError); cancelled {
+				return nil, "", submitted, err
+			}
+
+			if existed || (!submitted && !isRegionalPlacementError(err)) {
+				return nil, "", submitted, err
+			}
+
+			if submitted {
+				if cleanupErr := placer.cleanup(); cleanupErr != nil {
+					log.Warningf("failed to delete container group %s after failed deployment in region %s; %s", containerGroupName, region, cleanupErr.Error())
+					placementErr.Attempts = append(placementErr.Attempts, ContainerPlacementAttempt{Region: region, Err: err})
+					return nil, "", true, placementErr
+				}
+			}
+		}
+		if ctx.Err() != nil {
+			return nil, "", false, ctx.Err()
+		}
+
+		log.Warningf("failed to place container group %s in region %s; %s", containerGroupName, region, err.Error())
+		placementErr.Attempts = append(placementErr.Attempts, ContainerPlacementAttempt{Region: region, Err: err})
+	}
+
+	return nil, "", false, placementErr
+}
+
+// isRegionalPlacementError returns true if the given error is specific to the region in which the container group
+// was placed, such that another region may succeed: the region lacks capability, quota or capacity
+func isRegionalPlacementError(err error) bool {
+	switch e := err.(type) {
+	case *ContainerPreflightError, *ContainerResourceLimitError:
+		return true
+	case autorest.DetailedError:
+		switch original := e.Original.(type) {
+		case *azure.ServiceError:
+			return isCapacityErrorCode(original.Code)
+		case *azure.RequestError:
+			return original.ServiceError != nil && isCapacityErrorCode(original.ServiceError.Code)
+		}
+	}
+	return false
+}
+
+// isCapacityErrorCode returns true if the given Azure error code reports that the region lacks the capacity or
+// quota for the container group, or does not offer it; conflicts on the name or state of the container group
+// are not specific to the region
+func isCapacityErrorCode(code string) bool {
+	switch code {
+	case "ServiceUnavailable", "SkuNotAvailable", "LocationNotAvailableForResourceType":
+		return true
+	}
+	return strings.Contains(code, "Quota") || strings.Contains(code, "Capacity")
+}
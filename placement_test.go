@@ -0,0 +1,185 @@
+package azurewrapper
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/azure"
+
+	provide "github.com/provideplatform/provide-go/api/c2"
+)
+
+func TestSelectContainerRegionWithoutRegions(t *testing.T) {
+	_, err := SelectContainerRegion(context.Background(), reconcileTestParams(), tc, nil, []string{})
+	if err == nil {
+		t.Errorf("expected error without regions")
+	}
+}
+
+func TestStartContainerFailoverRejectsInvalidParams(t *testing.T) {
+	cp := reconcileTestParams()
+	cp.Image = nil
+
+	_, err := StartContainerWithOptions(context.Background(), cp, tc, &ContainerOptions{
+		Regions: []string{"eastus", "westus2"},
+	})
+	if err == nil {
+		t.Fatalf("expected error without image")
+	}
+	if _, ok := err.(*ContainerPlacementError); ok {
+		t.Errorf("expected invalid params not to fail over; got %v", err)
+	}
+}
+
+type testContainerPlacer struct {
+	preflightErrs map[string]error
+	startErrs     map[string]error
+	submitted     map[string]bool
+	started       []string
+	cleanups      int
+}
+
+func (p *testContainerPlacer) preflight(ctx context.Context, region string) error {
+	return p.preflightErrs[region]
+}
+
+func (p *testContainerPlacer) start(ctx context.Context, region string) (*provide.ContainerCreateResult, bool, error) {
+	p.started = append(p.started, region)
+	if err := p.startErrs[region]; err != nil {
+		return nil, p.submitted[region], err
+	}
+	return &provide.ContainerCreateResult{ContainerIds: []string{"test"}}, true, nil
+}
+
+func (p *testContainerPlacer) cleanup() error {
+	p.cleanups++
+	return nil
+}
+
+func TestPlaceContainerGroupFailsOver(t *testing.T) {
+	placer := &testContainerPlacer{
+		preflightErrs: map[string]error{"eastus": &ContainerPreflightError{Region: "eastus", Reasons: []string{"core quota exhausted"}}},
+		startErrs:     map[string]error{"westus2": fmt.Errorf("container group failed")},
+		submitted:     map[string]bool{"westus2": true},
+	}
+
+	result, region, submitted, err := placeContainerGroup(context.Background(), placer, "test", []string{"eastus", "westus2", "centralus"}, false)
+	if err != nil {
+		t.Fatalf("expected container group to be placed; %s", err.Error())
+	}
+	if region != "centralus" || result == nil || !submitted {
+		t.Errorf("expected container group to be placed in centralus; got %s", region)
+	}
+	if len(placer.started) != 2 || placer.started[0] != "westus2" {
+		t.Errorf("expected deployment in each region passing the preflight; got %v", placer.started)
+	}
+	if placer.cleanups != 1 {
+		t.Errorf("expected the failed deployment to be cleaned up once; got %d", placer.cleanups)
+	}
+}
+
+func TestPlaceContainerGroupReportsEachRegion(t *testing.T) {
+	placer := &testContainerPlacer{
+		startErrs: map[string]error{
+			"eastus":  autorest.DetailedError{StatusCode: http.StatusConflict, Original: &azure.ServiceError{Code: "ServiceUnavailable"}},
+			"westus2": fmt.Errorf("container group failed"),
+		},
+		submitted: map[string]bool{"westus2": true},
+	}
+
+	_, _, _, err := placeContainerGroup(context.Background(), placer, "test", []string{"eastus", "westus2"}, false)
+	placementErr, ok := err.(*ContainerPlacementError)
+	if !ok {
+		t.Fatalf("expected placement error; got %v", err)
+	}
+	if len(placementErr.Attempts) != 2 || placementErr.Attempts[0].Region != "eastus" || placementErr.Attempts[1].Region != "westus2" {
+		t.Errorf("expected an attempt per region in ranked order; got %+v", placementErr.Attempts)
+	}
+	if placer.cleanups != 1 {
+		t.Errorf("expected only the submitted container group to be cleaned up; got %d cleanups", placer.cleanups)
+	}
+}
+
+func TestPlaceContainerGroupStopsOnRegionIndependentError(t *testing.T) {
+	for _, startErr := range []error{
+		autorest.DetailedError{StatusCode: http.StatusBadRequest, Original: &azure.ServiceError{Code: "InvalidContainerGroupName"}},
+		autorest.DetailedError{StatusCode: http.StatusConflict, Original: &azure.ServiceError{Code: "Conflict"}},
+	} {
+		placer := &testContainerPlacer{
+			startErrs: map[string]error{"eastus": startErr},
+		}
+
+		_, _, _, err := placeContainerGroup(context.Background(), placer, "test", []string{"eastus", "westus2"}, false)
+		if _, ok := err.(*ContainerPlacementError); ok || err == nil {
+			t.Errorf("expected region-independent error to be returned without failing over; got %v", err)
+		}
+		if len(placer.started) != 1 || placer.cleanups != 0 {
+			t.Errorf("expected a single attempt without cleanup; got %v and %d cleanups", placer.started, placer.cleanups)
+		}
+	}
+}
+
+func TestIsRegionalPlacementError(t *testing.T) {
+	if !isRegionalPlacementError(autorest.DetailedError{StatusCode: http.StatusForbidden, Original: &azure.RequestError{ServiceError: &azure.ServiceError{Code: "ContainerGroupQuotaReached"}}}) {
+		t.Errorf("expected quota error to be regional")
+	}
+	if isRegionalPlacementError(autorest.DetailedError{StatusCode: http.StatusServiceUnavailable}) {
+		t.Errorf("expected error without a capacity or quota code not to be regional")
+	}
+	if isRegionalPlacementError(fmt.Errorf("invalid image")) {
+		t.Errorf("expected validation error not to be regional")
+	}
+}
+
+func TestStartContainerFailoverRejectsSubnet(t *testing.T) {
+	_, err := StartContainerWithOptions(context.Background(), reconcileTestParams(), tc, &ContainerOptions{
+		Regions:  []string{"eastus", "westus2"},
+		SubnetID: "/subscriptions/sub/resourceGroups/network/providers/Microsoft.Network/virtualNetworks/vnet/subnets/containers",
+	})
+	if err == nil || !strings.Contains(err.Error(), "cannot fail over") {
+		t.Errorf("expected subnet deployment not to fail over; got %v", err)
+	}
+}
+
+func TestPlaceContainerGroupRetainsExistingContainerGroup(t *testing.T) {
+	placer := &testContainerPlacer{
+		startErrs: map[string]error{"eastus": fmt.Errorf("container group failed")},
+		submitted: map[string]bool{"eastus": true},
+	}
+
+	_, _, _, err := placeContainerGroup(context.Background(), placer, "test", []string{"eastus"}, true)
+	if err == nil {
+		t.Fatalf("expected failed update to be returned")
+	}
+	if placer.cleanups != 0 {
+		t.Errorf("expected existing container group not to be deleted; got %d cleanups", placer.cleanups)
+	}
+}
+
+func TestExistingContainerGroupRegions(t *testing.T) {
+	regions, err := existingContainerGroupRegions("test", "East US", []string{"westus2", "eastus"})
+	if err != nil || len(regions) != 1 || regions[0] != "eastus" {
+		t.Errorf("expected only the region of the existing container group; got %v, %v", regions, err)
+	}
+
+	_, err = existingContainerGroupRegions("test", "eastus", []string{"westus2"})
+	if err == nil {
+		t.Errorf("expected error when the existing container group is in none of the regions")
+	}
+}
+
+func TestContainerPlacementError(t *testing.T) {
+	err := &ContainerPlacementError{
+		Attempts: []ContainerPlacementAttempt{
+			{Region: "eastus", Err: fmt.Errorf("core quota exhausted")},
+			{Region: "westus2", Err: fmt.Errorf("Windows container groups with a public IP address are not supported")},
+		},
+	}
+	if !strings.Contains(err.Error(), "eastus: core quota exhausted") || !strings.Contains(err.Error(), "westus2: Windows") {
+		t.Errorf("expected each region to be described; got %s", err.Error())
+	}
+}
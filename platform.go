@@ -0,0 +1,49 @@
+package azurewrapper
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/containerinstance/mgmt/2018-10-01/containerinstance"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+// containerOSType resolves the container group OS type, which defaults to Linux
+func containerOSType(opts *ContainerOptions) (containerinstance.OperatingSystemTypes, error) {
+	if opts == nil || opts.OsType == "" {
+		return containerinstance.Linux, nil
+	}
+
+	for _, osType := range containerinstance.PossibleOperatingSystemTypesValues() {
+		if strings.EqualFold(string(opts.OsType), string(osType)) {
+			return osType, nil
+		}
+	}
+
+	return "", fmt.Errorf("unsupported container OS type: %s", opts.OsType)
+}
+
+// validateContainerOSFeatures returns an error if the requested container group uses features
+// which are not supported by ACI for the given OS type
+func validateContainerOSFeatures(osType containerinstance.OperatingSystemTypes, opts *ContainerOptions) error {
+	if osType != containerinstance.Windows {
+		return nil
+	}
+
+	if opts != nil && opts.SubnetID != "" {
+		return fmt.Errorf("Windows container groups cannot be deployed into a virtual network")
+	}
+
+	if opts != nil {
+		for _, volume := range opts.Volumes {
+			if volume.AzureFile != nil {
+				return fmt.Errorf("Windows container groups do not support Azure file share volume: %s", to.String(volume.Name))
+			}
+			if volume.GitRepo != nil {
+				return fmt.Errorf("Windows container groups do not support git repo volume: %s", to.String(volume.Name))
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package azurewrapper
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/containerinstance/mgmt/2018-10-01/containerinstance"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+func TestContainerOSType(t *testing.T) {
+	osType, err := containerOSType(nil)
+	if err != nil || osType != containerinstance.Linux {
+		t.Errorf("expected Linux to be the default OS type")
+	}
+
+	osType, err = containerOSType(&ContainerOptions{OsType: "windows"})
+	if err != nil || osType != containerinstance.Windows {
+		t.Errorf("expected Windows OS type")
+	}
+
+	_, err = containerOSType(&ContainerOptions{OsType: "plan9"})
+	if err == nil {
+		t.Errorf("expected error for unsupported OS type")
+	}
+}
+
+func TestValidateContainerOSFeatures(t *testing.T) {
+	opts := &ContainerOptions{
+		Volumes: []containerinstance.Volume{
+			{
+				Name:      to.StringPtr("genesis"),
+				AzureFile: &containerinstance.AzureFileVolume{ShareName: to.StringPtr("genesis")},
+			},
+		},
+	}
+
+	if err := validateContainerOSFeatures(containerinstance.Linux, opts); err != nil {
+		t.Errorf("expected Linux to support Azure file share volumes; %s", err.Error())
+	}
+	if err := validateContainerOSFeatures(containerinstance.Windows, opts); err == nil {
+		t.Errorf("expected error for Azure file share volume on Windows")
+	}
+
+	subnetOpts := &ContainerOptions{SubnetID: "/subscriptions/sub/resourceGroups/network/providers/Microsoft.Network/virtualNetworks/vnet/subnets/containers"}
+	if err := validateContainerOSFeatures(containerinstance.Windows, subnetOpts); err == nil {
+		t.Errorf("expected error for virtual network deployment on Windows")
+	}
+
+	vnetParams := reconcileTestParams()
+	vnetParams.VirtualNetworkID = to.StringPtr("vnet")
+	vnetParams.SubnetIds = []string{"subnet1"}
+	if _, err := containerGroupFromParams(vnetParams, tc, &ContainerOptions{OsType: containerinstance.Windows}); err != nil {
+		t.Errorf("expected the virtual network and subnet IDs of the container params not to be checked; %s", err.Error())
+	}
+
+	if err := validateContainerOSFeatures(containerinstance.Windows, &ContainerOptions{
+		Volumes: []containerinstance.Volume{{Name: to.StringPtr("scratch"), EmptyDir: map[string]interface{}{}}},
+	}); err != nil {
+		t.Errorf("expected Windows to support empty dir volumes; %s", err.Error())
+	}
+}
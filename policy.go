@@ -0,0 +1,337 @@
+package azurewrapper
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	provide "github.com/provideplatform/provide-go/api/c2"
+)
+
+// SecurityProtocolTCP and SecurityProtocolUDP are the protocols supported by security rules
+const SecurityProtocolTCP = "tcp"
+const SecurityProtocolUDP = "udp"
+
+var serviceTagPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]*(\.[A-Za-z0-9]+)?$`)
+
+const securityPolicyIngressKey = "ingress"
+const securityPolicyEgressKey = "egress"
+
+// PortRange is an inclusive range of ports; a single port has equal `From` and `To`
+type PortRange struct {
+	From int32 `json:"from"`
+	To   int32 `json:"to"`
+}
+
+// allPorts is the port range given as `"*"` in the security config
+var allPorts = PortRange{From: 1, To: math.MaxUint16}
+
+// String formats the port range as expected by network security rules
+func (r PortRange) String() string {
+	if r == allPorts {
+		return "*"
+	}
+	if r.From == r.To {
+		return strconv.Itoa(int(r.From))
+	}
+	return fmt.Sprintf("%d-%d", r.From, r.To)
+}
+
+// SecurityRule allows traffic of the given protocol on the given ports to or from the given CIDR or
+// Azure service tag (i.e., `Storage` or `AzureCloud.eastus`); exactly one of `CIDR` and `ServiceTag` is required
+type SecurityRule struct {
+	CIDR       string      `json:"cidr,omitempty"`
+	ServiceTag string      `json:"service_tag,omitempty"`
+	Protocol   string      `json:"protocol"`
+	Ports      []PortRange `json:"ports"`
+}
+
+// addressPrefix returns the CIDR or service tag of the rule
+func (r *SecurityRule) addressPrefix() string {
+	if r.ServiceTag != "" {
+		return r.ServiceTag
+	}
+	return r.CIDR
+}
+
+// SecurityPolicy is a typed representation of the `security` config given in the container params;
+// ingress and egress rules are allowlists. When `EgressUnrestricted` is true, all outbound traffic is allowed
+type SecurityPolicy struct {
+	Ingress            []SecurityRule `json:"ingress"`
+	Egress             []SecurityRule `json:"egress"`
+	EgressUnrestricted bool           `json:"egress_unrestricted"`
+}
+
+// securityPort is a single port and protocol exposed by a security policy
+type securityPort struct {
+	Protocol string
+	Port     int32
+}
+
+// ParseSecurityPolicy parses the security config map in which `ingress` and `egress` are keyed by CIDR or
+// service tag, each mapping protocols to lists of ports (i.e., `{"ingress": {"0.0.0.0/0": {"tcp": [4222]}}}`);
+// ports may be numbers or strings, including ranges (i.e., `"8000-8010"`) and `"*"` for all ports. A missing egress
+// config, or `"egress": "*"`, leaves outbound traffic unrestricted
+func ParseSecurityPolicy(security map[string]interface{}) (*SecurityPolicy, error) {
+	policy := &SecurityPolicy{
+		Ingress:            make([]SecurityRule, 0),
+		Egress:             make([]SecurityRule, 0),
+		EgressUnrestricted: true,
+	}
+	if security == nil {
+		return policy, nil
+	}
+
+	if ingress, ingressOk := security[securityPolicyIngressKey]; ingressOk && ingress != nil {
+		rules, err := parseSecurityRules(securityPolicyIngressKey, ingress)
+		if err != nil {
+			return nil, err
+		}
+		policy.Ingress = rules
+	}
+
+	if egress, egressOk := security[securityPolicyEgressKey]; egressOk && egress != nil {
+		if str, strOk := egress.(string); strOk && strings.TrimSpace(str) == "*" {
+			return policy, policy.Validate()
+		}
+		rules, err := parseSecurityRules(securityPolicyEgressKey, egress)
+		if err != nil {
+			return nil, err
+		}
+		policy.Egress = rules
+		policy.EgressUnrestricted = false
+	}
+
+	return policy, policy.Validate()
+}
+
+// containerSecurityPolicy returns the security policy given in the container options, if any, or parses the
+// security config of the container params
+func containerSecurityPolicy(cp *provide.ContainerParams, opts *ContainerOptions) (*SecurityPolicy, error) {
+	if opts != nil && opts.SecurityPolicy != nil {
+		return opts.SecurityPolicy, opts.SecurityPolicy.Validate()
+	}
+	return ParseSecurityPolicy(cp.Security)
+}
+
+// Validate returns an error if any rule in the security policy is invalid
+func (p *SecurityPolicy) Validate() error {
+	for _, rule := range p.Ingress {
+		err := rule.validate()
+		if err != nil {
+			return fmt.Errorf("invalid ingress rule for %s; %s", rule.addressPrefix(), err.Error())
+		}
+	}
+	for _, rule := range p.Egress {
+		err := rule.validate()
+		if err != nil {
+			return fmt.Errorf("invalid egress rule for %s; %s", rule.addressPrefix(), err.Error())
+		}
+	}
+	return nil
+}
+
+// RestrictedIngressCIDRs returns the sorted ingress CIDRs and service tags which restrict access to a subset of source addresses
+func (p *SecurityPolicy) RestrictedIngressCIDRs() []string {
+	seen := map[string]bool{}
+	cidrs := make([]string, 0)
+	for _, rule := range p.Ingress {
+		prefix := rule.addressPrefix()
+		if !isUnrestrictedCIDR(prefix) && !seen[prefix] {
+			seen[prefix] = true
+			cidrs = append(cidrs, prefix)
+		}
+	}
+	sort.Strings(cidrs)
+	return cidrs
+}
+
+// maxIngressPorts is the maximum number of individual ports the ingress rules may expose on the public IP address of
+// a container group or on a load balancer; wider port ranges can only be enforced by network security groups
+const maxIngressPorts = 100
+
+// ingressPorts returns the unique ports exposed by the ingress rules, in the order they are first given;
+// port ranges are expanded since public IP addresses and load balancers expose individual ports, so an error
+// is returned when more than maxIngressPorts ports would be exposed
+func (p *SecurityPolicy) ingressPorts() ([]securityPort, error) {
+	for _, rule := range p.Ingress {
+		for _, portRange := range rule.Ports {
+			if int(portRange.To)-int(portRange.From)+1 > maxIngressPorts {
+				return nil, fmt.Errorf("ingress port range %s exposes more than %d ports", portRange.String(), maxIngressPorts)
+			}
+		}
+	}
+
+	ports := p.expandedIngressPorts()
+	if len(ports) > maxIngressPorts {
+		return nil, fmt.Errorf("ingress rules expose more than %d ports", maxIngressPorts)
+	}
+	return ports, nil
+}
+
+// subnetIngressPorts returns the ports declared on the private IP address of a container group deployed into a
+// subnet; the network security group of the subnet enforces the port ranges of the ingress rules, so ranges wider
+// than maxIngressPorts are declared by their first port rather than rejected
+func (p *SecurityPolicy) subnetIngressPorts() []securityPort {
+	return p.expandedIngressPorts()
+}
+
+// expandedIngressPorts returns the unique ports of the ingress rules in the order they are first given, expanding
+// port ranges of at most maxIngressPorts ports and representing wider ranges by their first port
+func (p *SecurityPolicy) expandedIngressPorts() []securityPort {
+	seen := map[securityPort]bool{}
+	ports := make([]securityPort, 0)
+	for _, rule := range p.Ingress {
+		for _, portRange := range rule.Ports {
+			last := portRange.To
+			if int(portRange.To)-int(portRange.From)+1 > maxIngressPorts {
+				last = portRange.From
+			}
+			for port := portRange.From; port <= last; port++ {
+				sp := securityPort{Protocol: rule.Protocol, Port: port}
+				if !seen[sp] {
+					seen[sp] = true
+					ports = append(ports, sp)
+				}
+			}
+		}
+	}
+	return ports
+}
+
+// validate returns an error if the CIDR or service tag, protocol or any port range of the rule is invalid
+func (r *SecurityRule) validate() error {
+	if r.ServiceTag != "" {
+		if r.CIDR != "" {
+			return fmt.Errorf("CIDR and service tag are mutually exclusive")
+		}
+		if !serviceTagPattern.MatchString(r.ServiceTag) {
+			return fmt.Errorf("invalid service tag: %s", r.ServiceTag)
+		}
+	} else if !isUnrestrictedCIDR(r.CIDR) {
+		if _, _, err := net.ParseCIDR(r.CIDR); err != nil {
+			return fmt.Errorf("invalid CIDR: %s", r.CIDR)
+		}
+	}
+
+	if r.Protocol != SecurityProtocolTCP && r.Protocol != SecurityProtocolUDP {
+		return fmt.Errorf("unsupported protocol: %s", r.Protocol)
+	}
+
+	if len(r.Ports) == 0 {
+		return fmt.Errorf("no %s ports given", r.Protocol)
+	}
+	for _, portRange := range r.Ports {
+		if portRange.From < 1 || portRange.To > math.MaxUint16 || portRange.From > portRange.To {
+			return fmt.Errorf("invalid %s port range: %s", r.Protocol, portRange.String())
+		}
+	}
+
+	return nil
+}
+
+// parseSecurityRules parses the CIDR- or service tag-keyed rules of the ingress or egress config, sorted by key and protocol
+func parseSecurityRules(direction string, cfg interface{}) ([]SecurityRule, error) {
+	cidrCfg, ok := cfg.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid %s config: expected map of CIDR to protocol ports; got %T", direction, cfg)
+	}
+
+	cidrs := make([]string, 0, len(cidrCfg))
+	for cidr := range cidrCfg {
+		cidrs = append(cidrs, cidr)
+	}
+	sort.Strings(cidrs)
+
+	rules := make([]SecurityRule, 0)
+	for _, cidr := range cidrs {
+		protocolCfg, ok := cidrCfg[cidr].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid %s config for %s: expected map of protocol to ports; got %T", direction, cidr, cidrCfg[cidr])
+		}
+
+		protocols := make([]string, 0, len(protocolCfg))
+		for protocol := range protocolCfg {
+			protocols = append(protocols, protocol)
+		}
+		sort.Strings(protocols)
+
+		for _, protocol := range protocols {
+			ports, ok := protocolCfg[protocol].([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("invalid %s config for %s: expected list of %s ports; got %T", direction, cidr, protocol, protocolCfg[protocol])
+			}
+			if len(ports) == 0 {
+				continue
+			}
+
+			rule := SecurityRule{
+				Protocol: strings.ToLower(protocol),
+				Ports:    make([]PortRange, 0, len(ports)),
+			}
+			if isServiceTag(cidr) {
+				rule.ServiceTag = cidr
+			} else {
+				rule.CIDR = cidr
+			}
+			for _, port := range ports {
+				portRange, err := parsePortRange(port)
+				if err != nil {
+					return nil, fmt.Errorf("invalid %s config for %s: %s", direction, cidr, err.Error())
+				}
+				rule.Ports = append(rule.Ports, *portRange)
+			}
+			rules = append(rules, rule)
+		}
+	}
+
+	return rules, nil
+}
+
+// isServiceTag returns true if the given security config key is a service tag rather than a CIDR
+func isServiceTag(key string) bool {
+	return !isUnrestrictedCIDR(key) && serviceTagPattern.MatchString(key)
+}
+
+// parsePortRange parses a port given as a number, a numeric string or a `from-to` range string
+func parsePortRange(port interface{}) (*PortRange, error) {
+	switch p := port.(type) {
+	case float64:
+		if p != math.Trunc(p) || p < 0 || p > math.MaxUint16 {
+			return nil, fmt.Errorf("invalid port: %v", p)
+		}
+		return &PortRange{From: int32(p), To: int32(p)}, nil
+	case int:
+		return parsePortRange(float64(p))
+	case int32:
+		return parsePortRange(float64(p))
+	case int64:
+		return parsePortRange(float64(p))
+	case json.Number:
+		return parsePortRange(p.String())
+	case string:
+		if strings.TrimSpace(p) == "*" {
+			return &PortRange{From: allPorts.From, To: allPorts.To}, nil
+		}
+		bounds := strings.SplitN(strings.TrimSpace(p), "-", 2)
+		from, err := strconv.ParseUint(strings.TrimSpace(bounds[0]), 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port: %s", p)
+		}
+		to := from
+		if len(bounds) == 2 {
+			to, err = strconv.ParseUint(strings.TrimSpace(bounds[1]), 10, 16)
+			if err != nil {
+				return nil, fmt.Errorf("invalid port range: %s", p)
+			}
+		}
+		return &PortRange{From: int32(from), To: int32(to)}, nil
+	}
+
+	return nil, fmt.Errorf("invalid port: %v", port)
+}
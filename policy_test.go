@@ -0,0 +1,156 @@
+package azurewrapper
+
+import (
+	"testing"
+)
+
+func TestParseSecurityPolicy(t *testing.T) {
+	policy, err := ParseSecurityPolicy(map[string]interface{}{
+		"egress": "*",
+		"ingress": map[string]interface{}{
+			"0.0.0.0/0": map[string]interface{}{
+				"tcp": []interface{}{float64(4222), "8000-8002", 4222},
+				"udp": []interface{}{},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("expected security policy; %s", err.Error())
+	}
+
+	if !policy.EgressUnrestricted || len(policy.Egress) != 0 {
+		t.Errorf("expected unrestricted egress")
+	}
+	if len(policy.Ingress) != 1 || policy.Ingress[0].Protocol != SecurityProtocolTCP {
+		t.Fatalf("expected a single tcp ingress rule; got %+v", policy.Ingress)
+	}
+	if policy.Ingress[0].Ports[1] != (PortRange{From: 8000, To: 8002}) {
+		t.Errorf("expected port range to be parsed; got %+v", policy.Ingress[0].Ports[1])
+	}
+
+	ports, err := policy.ingressPorts()
+	if err != nil || len(ports) != 4 || ports[0].Port != 4222 || ports[3].Port != 8002 {
+		t.Errorf("expected unique ports in the order given; got %+v", ports)
+	}
+}
+
+func TestIngressPortsBounded(t *testing.T) {
+	policy := &SecurityPolicy{
+		Ingress: []SecurityRule{
+			{CIDR: "0.0.0.0/0", Protocol: SecurityProtocolTCP, Ports: []PortRange{{From: 1, To: 65535}}},
+		},
+	}
+	if _, err := policy.ingressPorts(); err == nil {
+		t.Errorf("expected port range wider than %d ports to be rejected", maxIngressPorts)
+	}
+
+	policy.Ingress[0].Ports = []PortRange{{From: 8000, To: 8079}, {From: 9000, To: 9079}}
+	if _, err := policy.ingressPorts(); err == nil {
+		t.Errorf("expected more than %d ports in total to be rejected", maxIngressPorts)
+	}
+
+	policy.Ingress[0].Ports = []PortRange{{From: 8000, To: 8099}}
+	if ports, err := policy.ingressPorts(); err != nil || len(ports) != maxIngressPorts {
+		t.Errorf("expected %d ports to be exposed", maxIngressPorts)
+	}
+}
+
+func TestSubnetIngressPortsUnbounded(t *testing.T) {
+	policy := &SecurityPolicy{
+		Ingress: []SecurityRule{
+			{CIDR: "10.0.0.0/8", Protocol: SecurityProtocolTCP, Ports: []PortRange{{From: 4222, To: 4222}, {From: 8000, To: 8999}, {From: 9000, To: 9001}}},
+		},
+	}
+	ports := policy.subnetIngressPorts()
+	if len(ports) != 4 || ports[1].Port != 8000 || ports[3].Port != 9001 {
+		t.Errorf("expected wide port range to be declared by its first port; got %+v", ports)
+	}
+}
+
+func TestParseSecurityPolicyAllPorts(t *testing.T) {
+	policy, err := ParseSecurityPolicy(map[string]interface{}{
+		"egress": map[string]interface{}{
+			"Storage": map[string]interface{}{
+				"tcp": []interface{}{"*"},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("expected security policy; %s", err.Error())
+	}
+	if len(policy.Egress) != 1 || policy.Egress[0].Ports[0] != allPorts {
+		t.Fatalf("expected egress rule for all ports; got %+v", policy.Egress)
+	}
+	if portRanges := securityRulePortRanges(policy.Egress[0]); len(portRanges) != 1 || portRanges[0] != "*" {
+		t.Errorf("expected all ports to be formatted as *; got %v", portRanges)
+	}
+}
+
+func TestParseSecurityPolicyEgress(t *testing.T) {
+	policy, err := ParseSecurityPolicy(map[string]interface{}{
+		"egress": map[string]interface{}{
+			"10.0.0.0/8": map[string]interface{}{
+				"tcp": []interface{}{float64(443)},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("expected security policy; %s", err.Error())
+	}
+	if policy.EgressUnrestricted || len(policy.Egress) != 1 {
+		t.Errorf("expected restricted egress; got %+v", policy)
+	}
+
+	policy, err = ParseSecurityPolicy(map[string]interface{}{
+		"egress": map[string]interface{}{
+			"AzureCloud.eastus": map[string]interface{}{
+				"tcp": []interface{}{float64(443)},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("expected security policy; %s", err.Error())
+	}
+	if policy.Egress[0].ServiceTag != "AzureCloud.eastus" || policy.Egress[0].CIDR != "" {
+		t.Errorf("expected service tag egress rule; got %+v", policy.Egress[0])
+	}
+}
+
+func TestParseSecurityPolicyInvalid(t *testing.T) {
+	invalid := []map[string]interface{}{
+		{"ingress": "0.0.0.0/0"},
+		{"ingress": map[string]interface{}{"0.0.0.0/0": []interface{}{float64(22)}}},
+		{"ingress": map[string]interface{}{"0.0.0.0/0": map[string]interface{}{"tcp": float64(22)}}},
+		{"ingress": map[string]interface{}{"0.0.0.0/0": map[string]interface{}{"tcp": []interface{}{float64(22.5)}}}},
+		{"ingress": map[string]interface{}{"0.0.0.0/0": map[string]interface{}{"tcp": []interface{}{float64(70000)}}}},
+		{"ingress": map[string]interface{}{"0.0.0.0/0": map[string]interface{}{"tcp": []interface{}{"9000-8000"}}}},
+		{"ingress": map[string]interface{}{"0.0.0.0/0": map[string]interface{}{"icmp": []interface{}{float64(1)}}}},
+		{"ingress": map[string]interface{}{"10.0.0.300/8": map[string]interface{}{"tcp": []interface{}{float64(22)}}}},
+		{"egress": map[string]interface{}{"10.0.0.0/8": map[string]interface{}{"tcp": []interface{}{true}}}},
+		{"egress": map[string]interface{}{"Azure Cloud": map[string]interface{}{"tcp": []interface{}{float64(443)}}}},
+	}
+
+	for _, security := range invalid {
+		if _, err := ParseSecurityPolicy(security); err == nil {
+			t.Errorf("expected invalid security config to be rejected: %v", security)
+		}
+	}
+}
+
+func TestContainerSecurityPolicyPrecedence(t *testing.T) {
+	cp := reconcileTestParams()
+	policy := &SecurityPolicy{
+		Ingress: []SecurityRule{
+			{CIDR: "0.0.0.0/0", Protocol: SecurityProtocolUDP, Ports: []PortRange{{From: 53, To: 53}}},
+		},
+		EgressUnrestricted: true,
+	}
+
+	resolved, err := containerSecurityPolicy(cp, &ContainerOptions{SecurityPolicy: policy})
+	if err != nil {
+		t.Fatalf("expected security policy; %s", err.Error())
+	}
+	if resolved != policy {
+		t.Errorf("expected container options security policy to take precedence")
+	}
+}
@@ -0,0 +1,254 @@
+package azurewrapper
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/containerinstance/mgmt/2018-10-01/containerinstance"
+	"github.com/Azure/go-autorest/autorest/to"
+
+	provide "github.com/provideplatform/provide-go/api/c2"
+)
+
+const capabilityResourceTypeContainerGroups = "containerGroups"
+const capabilityGPUNone = "None"
+
+const usageContainerGroups = "ContainerGroups"
+const usageStandardCores = "StandardCores"
+
+// ContainerRegionCapacity is a struct representing the container group capabilities of a region and the
+// current usage of the subscription in that region
+type ContainerRegionCapacity struct {
+	Region       string
+	Capabilities []containerinstance.Capabilities
+	Usage        []containerinstance.Usage
+}
+
+// ContainerPreflightError is returned when a container group cannot be deployed to a region; each reason
+// describes a requirement which is not met and how to address it
+type ContainerPreflightError struct {
+	Region  string
+	Reasons []string
+}
+
+func (e *ContainerPreflightError) Error() string {
+	return fmt.Sprintf("container group cannot be deployed to region %s; %s", e.Region, strings.Join(e.Reasons, "; "))
+}
+
+// GetContainerRegionCapacity returns the container group capabilities and usage for the given region
+func GetContainerRegionCapacity(ctx context.Context, tc *provide.TargetCredentials, region string) (*ContainerRegionCapacity, error) {
+	ciClient, err := NewContainerInstanceClient(tc)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get container instance client: %s; ", err.Error())
+	}
+
+	usageClient, err := NewContainerGroupUsageClient(tc)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get container group usage client: %s; ", err.Error())
+	}
+
+	capabilities, err := ciClient.ListCapabilities(ctx, region)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to list container capabilities in region: %s; %s", region, err.Error())
+	}
+
+	usage, err := usageClient.List(ctx, region)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to list container group usage in region: %s; %s", region, err.Error())
+	}
+
+	capacity := &ContainerRegionCapacity{
+		Region:       region,
+		Capabilities: make([]containerinstance.Capabilities, 0),
+		Usage:        make([]containerinstance.Usage, 0),
+	}
+	if capabilities.Value != nil {
+		capacity.Capabilities = append(capacity.Capabilities, *capabilities.Value...)
+	}
+	if usage.Value != nil {
+		capacity.Usage = append(capacity.Usage, *usage.Value...)
+	}
+
+	return capacity, nil
+}
+
+// PreflightContainer validates the container group described by the given params against the capabilities and
+// quota of its region, returning a ContainerPreflightError if it cannot be deployed
+func PreflightContainer(ctx context.Context, cp *provide.ContainerParams, tc *provide.TargetCredentials, opts *ContainerOptions) error {
+	loadContainerRegionResourceLimits(ctx, tc, cp)
+	containerGroup, err := containerGroupFromParams(cp, tc, opts)
+	if err != nil {
+		return err
+	}
+
+	existing, err := existingContainerGroupInRegion(ctx, tc, cp.ResourceGroupName, *cp.ContainerGroupName, cp.Region)
+	if err != nil {
+		return err
+	}
+
+	capacity, err := GetContainerRegionCapacity(ctx, tc, cp.Region)
+	if err != nil {
+		return err
+	}
+
+	return preflightContainerGroup(*containerGroup, existing, capacity)
+}
+
+// preflightContainerGroup validates the OS, IP address type, CPU and memory of the container group against the
+// capabilities of the region, and the container group and core quota against its usage; when the container group
+// already exists in the region, it is updated in place, so only the cores it adds are counted against the quota
+func preflightContainerGroup(containerGroup containerinstance.ContainerGroup, existing *containerinstance.ContainerGroup, capacity *ContainerRegionCapacity) error {
+	osType := string(containerGroup.OsType)
+	ipAddressType := ""
+	if containerGroup.IPAddress != nil {
+		ipAddressType = string(containerGroup.IPAddress.Type)
+	}
+	cpu, memoryInGB := containerGroupResources(containerGroup)
+
+	reasons := make([]string, 0)
+
+	maxCPU := float64(0)
+	maxMemoryInGB := float64(0)
+	supported := false
+	for _, capability := range capacity.Capabilities {
+		if !strings.EqualFold(to.String(capability.ResourceType), capabilityResourceTypeContainerGroups) {
+			continue
+		}
+		if !strings.EqualFold(to.String(capability.OsType), osType) {
+			continue
+		}
+		if ipAddressType != "" && !strings.EqualFold(to.String(capability.IPAddressType), ipAddressType) {
+			continue
+		}
+		if capability.Gpu != nil && !strings.EqualFold(*capability.Gpu, capabilityGPUNone) {
+			continue
+		}
+
+		supported = true
+		if capability.Capabilities != nil {
+			maxCPU = math.Max(maxCPU, to.Float64(capability.Capabilities.MaxCPU))
+			maxMemoryInGB = math.Max(maxMemoryInGB, to.Float64(capability.Capabilities.MaxMemoryInGB))
+		}
+	}
+
+	if !supported && ipAddressType == "" {
+		reasons = append(reasons, fmt.Sprintf("%s container groups are not supported; choose another region", osType))
+	} else if !supported {
+		reasons = append(reasons, fmt.Sprintf("%s container groups with a %s IP address are not supported; choose another region", osType, strings.ToLower(ipAddressType)))
+	} else {
+		if maxCPU > 0 && cpu > maxCPU {
+			reasons = append(reasons, fmt.Sprintf("requested %g CPU exceeds the maximum of %g per %s container group; reduce the CPU or choose another region", cpu, maxCPU, osType))
+		}
+		if maxMemoryInGB > 0 && memoryInGB > maxMemoryInGB {
+			reasons = append(reasons, fmt.Sprintf("requested %g GB memory exceeds the maximum of %g GB per %s container group; reduce the memory or choose another region", memoryInGB, maxMemoryInGB, osType))
+		}
+	}
+
+	if usage := containerUsage(capacity.Usage, usageContainerGroups); usage != nil && usage.Limit != nil && existing == nil {
+		if to.Int32(usage.CurrentValue)+1 > *usage.Limit {
+			reasons = append(reasons, fmt.Sprintf("container group quota exhausted: %d of %d in use; delete unused container groups, request a quota increase or choose another region", to.Int32(usage.CurrentValue), *usage.Limit))
+		}
+	}
+
+	if usage := containerUsage(capacity.Usage, usageStandardCores); usage != nil && usage.Limit != nil {
+		cores := int32(math.Ceil(cpu))
+		if existing != nil {
+			existingCPU, _ := containerGroupResources(*existing)
+			cores -= int32(math.Ceil(existingCPU))
+		}
+		if cores > 0 && to.Int32(usage.CurrentValue)+cores > *usage.Limit {
+			reasons = append(reasons, fmt.Sprintf("core quota exhausted: %d of %d cores in use and %d requested; request a quota increase or choose another region", to.Int32(usage.CurrentValue), *usage.Limit, cores))
+		}
+	}
+
+	if len(reasons) > 0 {
+		return &ContainerPreflightError{
+			Region:  capacity.Region,
+			Reasons: reasons,
+		}
+	}
+
+	return nil
+}
+
+// containerGroupResources returns the total CPU and memory of the containers in the group; the greater of the
+// request and limit of each container is used, since either may be billed against the quota
+func containerGroupResources(containerGroup containerinstance.ContainerGroup) (float64, float64) {
+	cpu := float64(0)
+	memoryInGB := float64(0)
+	if containerGroup.ContainerGroupProperties == nil || containerGroup.Containers == nil {
+		return cpu, memoryInGB
+	}
+
+	for _, container := range *containerGroup.Containers {
+		if container.ContainerProperties == nil || container.Resources == nil {
+			continue
+		}
+		containerCPU := float64(0)
+		containerMemoryInGB := float64(0)
+		if container.Resources.Requests != nil {
+			containerCPU = to.Float64(container.Resources.Requests.CPU)
+			containerMemoryInGB = to.Float64(container.Resources.Requests.MemoryInGB)
+		}
+		if container.Resources.Limits != nil {
+			containerCPU = math.Max(containerCPU, to.Float64(container.Resources.Limits.CPU))
+			containerMemoryInGB = math.Max(containerMemoryInGB, to.Float64(container.Resources.Limits.MemoryInGB))
+		}
+		cpu += containerCPU
+		memoryInGB += containerMemoryInGB
+	}
+
+	return cpu, memoryInGB
+}
+
+// containerUsage returns the usage with the given name, if any
+func containerUsage(usage []containerinstance.Usage, name string) *containerinstance.Usage {
+	for i := range usage {
+		if usage[i].Name != nil && strings.EqualFold(to.String(usage[i].Name.Value), name) {
+			return &usage[i]
+		}
+	}
+	return nil
+}
+
+// preflightContainerGroupIfRequested runs the preflight for the given container group when requested in the options
+func preflightContainerGroupIfRequested(ctx context.Context, tc *provide.TargetCredentials, cp *provide.ContainerParams, containerGroup containerinstance.ContainerGroup, opts *ContainerOptions) error {
+	if opts == nil || !opts.Preflight {
+		return nil
+	}
+
+	existing, err := existingContainerGroupInRegion(ctx, tc, cp.ResourceGroupName, *cp.ContainerGroupName, cp.Region)
+	if err != nil {
+		return err
+	}
+
+	capacity, err := GetContainerRegionCapacity(ctx, tc, cp.Region)
+	if err != nil {
+		return err
+	}
+
+	return preflightContainerGroup(containerGroup, existing, capacity)
+}
+
+// existingContainerGroupInRegion returns the container group with the given name if it exists in the given region
+func existingContainerGroupInRegion(ctx context.Context, tc *provide.TargetCredentials, resourceGroupName, containerGroupName, region string) (*containerinstance.ContainerGroup, error) {
+	cgClient, err := NewContainerGroupsClient(tc)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get container group client: %s; ", err.Error())
+	}
+
+	containerGroup, err := cgClient.Get(ctx, resourceGroupName, containerGroupName)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("Unable to get container group: %s; ", err.Error())
+	}
+	if normalizeRegion(to.String(containerGroup.Location)) != normalizeRegion(region) {
+		return nil, nil
+	}
+
+	return &containerGroup, nil
+}
@@ -0,0 +1,121 @@
+package azurewrapper
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/containerinstance/mgmt/2018-10-01/containerinstance"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+func preflightTestCapacity(containerGroupsInUse, coresInUse int32) *ContainerRegionCapacity {
+	return &ContainerRegionCapacity{
+		Region: "eastus",
+		Capabilities: []containerinstance.Capabilities{
+			{
+				ResourceType:  to.StringPtr("containerGroups"),
+				OsType:        to.StringPtr("Linux"),
+				IPAddressType: to.StringPtr("Public"),
+				Gpu:           to.StringPtr("None"),
+				Capabilities: &containerinstance.CapabilitiesCapabilities{
+					MaxCPU:        to.Float64Ptr(4),
+					MaxMemoryInGB: to.Float64Ptr(16),
+				},
+			},
+			{
+				ResourceType:  to.StringPtr("containerGroups"),
+				OsType:        to.StringPtr("Linux"),
+				IPAddressType: to.StringPtr("Public"),
+				Gpu:           to.StringPtr("K80"),
+				Capabilities: &containerinstance.CapabilitiesCapabilities{
+					MaxCPU:        to.Float64Ptr(6),
+					MaxMemoryInGB: to.Float64Ptr(56),
+				},
+			},
+		},
+		Usage: []containerinstance.Usage{
+			{Name: &containerinstance.UsageName{Value: to.StringPtr("ContainerGroups")}, CurrentValue: to.Int32Ptr(containerGroupsInUse), Limit: to.Int32Ptr(100)},
+			{Name: &containerinstance.UsageName{Value: to.StringPtr("StandardCores")}, CurrentValue: to.Int32Ptr(coresInUse), Limit: to.Int32Ptr(10)},
+		},
+	}
+}
+
+func TestPreflightContainerGroup(t *testing.T) {
+	containerGroup, err := containerGroupFromParams(reconcileTestParams(), tc, nil)
+	if err != nil {
+		t.Fatalf("expected container group; %s", err.Error())
+	}
+
+	if err := preflightContainerGroup(*containerGroup, nil, preflightTestCapacity(10, 2)); err != nil {
+		t.Errorf("expected preflight to pass; %s", err.Error())
+	}
+
+	err = preflightContainerGroup(*containerGroup, nil, preflightTestCapacity(100, 10))
+	preflightErr, ok := err.(*ContainerPreflightError)
+	if !ok {
+		t.Fatalf("expected preflight error; got %v", err)
+	}
+	if len(preflightErr.Reasons) != 2 || !strings.Contains(preflightErr.Error(), "core quota exhausted") {
+		t.Errorf("expected container group and core quota reasons; got %v", preflightErr.Reasons)
+	}
+}
+
+func TestPreflightExistingContainerGroup(t *testing.T) {
+	containerGroup, err := containerGroupFromParams(reconcileTestParams(), tc, nil)
+	if err != nil {
+		t.Fatalf("expected container group; %s", err.Error())
+	}
+
+	if err := preflightContainerGroup(*containerGroup, containerGroup, preflightTestCapacity(100, 10)); err != nil {
+		t.Errorf("expected in-place update of an existing container group not to count against exhausted quota; %s", err.Error())
+	}
+
+	cpu, _ := containerGroupResources(*containerGroup)
+	larger, _ := containerGroupFromParams(reconcileTestParams(), tc, &ContainerOptions{
+		Resources: &ContainerResources{CPURequest: to.Float64Ptr(cpu + 1)},
+	})
+	err = preflightContainerGroup(*larger, containerGroup, preflightTestCapacity(100, 10))
+	if err == nil || strings.Contains(err.Error(), "container group quota") || !strings.Contains(err.Error(), "core quota exhausted") {
+		t.Errorf("expected only the additional cores of an existing container group to be counted; got %v", err)
+	}
+}
+
+func TestPreflightContainerGroupWithoutIPAddress(t *testing.T) {
+	containerGroup, err := containerGroupFromParams(reconcileTestParams(), tc, &ContainerOptions{OsType: containerinstance.Windows})
+	if err != nil {
+		t.Fatalf("expected container group; %s", err.Error())
+	}
+	containerGroup.IPAddress = nil
+
+	err = preflightContainerGroup(*containerGroup, nil, preflightTestCapacity(0, 0))
+	if err == nil || !strings.Contains(err.Error(), "Windows container groups are not supported") {
+		t.Errorf("expected unsupported OS to be reported without an IP address type; got %v", err)
+	}
+}
+
+func TestPreflightContainerGroupCapabilities(t *testing.T) {
+	SetContainerRegionResourceLimits("eastus", ContainerResourceLimits{MaxCPU: 8, MaxMemoryInGB: 32})
+	defer ClearContainerRegionResourceLimits("eastus")
+
+	cp := reconcileTestParams()
+	containerGroup, err := containerGroupFromParams(cp, tc, &ContainerOptions{
+		Resources: &ContainerResources{CPURequest: to.Float64Ptr(5)},
+	})
+	if err != nil {
+		t.Fatalf("expected container group; %s", err.Error())
+	}
+
+	err = preflightContainerGroup(*containerGroup, nil, preflightTestCapacity(0, 0))
+	if err == nil || !strings.Contains(err.Error(), "exceeds the maximum of 4") {
+		t.Errorf("expected CPU to be validated against non-GPU capabilities; got %v", err)
+	}
+
+	containerGroup, err = containerGroupFromParams(cp, tc, &ContainerOptions{OsType: containerinstance.Windows})
+	if err != nil {
+		t.Fatalf("expected container group; %s", err.Error())
+	}
+	err = preflightContainerGroup(*containerGroup, nil, preflightTestCapacity(0, 0))
+	if err == nil || !strings.Contains(err.Error(), "Windows container groups") {
+		t.Errorf("expected unsupported OS to be reported; got %v", err)
+	}
+}
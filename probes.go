@@ -0,0 +1,180 @@
+package azurewrapper
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/containerinstance/mgmt/2018-10-01/containerinstance"
+	"github.com/Azure/go-autorest/autorest/to"
+
+	provide "github.com/provideplatform/provide-go/api/c2"
+)
+
+const defaultProbeHTTPPath = "/"
+const defaultProbeInitialDelaySeconds = int32(10)
+const defaultProbePeriodSeconds = int32(10)
+const defaultProbeFailureThreshold = int32(3)
+const defaultProbeSuccessThreshold = int32(1)
+const defaultProbeTimeoutSeconds = int32(5)
+
+const containerProbeLiveness = "liveness"
+const containerProbeReadiness = "readiness"
+
+// ContainerProbeParams configures an HTTP or exec liveness/readiness probe for a container;
+// when neither `Exec` nor `HTTPPort` is given, an HTTP probe against the first TCP ingress port is used
+type ContainerProbeParams struct {
+	Exec                []string
+	HTTPPath            *string
+	HTTPPort            *int32
+	HTTPScheme          *string
+	InitialDelaySeconds *int32
+	PeriodSeconds       *int32
+	FailureThreshold    *int32
+	SuccessThreshold    *int32
+	TimeoutSeconds      *int32
+}
+
+// ContainerProbeFailure represents a failed liveness or readiness probe reported by a container
+type ContainerProbeFailure struct {
+	ContainerName  string
+	Probe          string
+	Count          int32
+	Message        string
+	FirstTimestamp *time.Time
+	LastTimestamp  *time.Time
+}
+
+// containerProbe builds the Azure probe for the given params, defaulting the HTTP port
+// to the first TCP port exposed via ingress
+func containerProbe(params *ContainerProbeParams, portMappings []containerinstance.Port) (*containerinstance.ContainerProbe, error) {
+	if params == nil {
+		return nil, nil
+	}
+
+	probe := &containerinstance.ContainerProbe{
+		InitialDelaySeconds: to.Int32Ptr(defaultProbeInitialDelaySeconds),
+		PeriodSeconds:       to.Int32Ptr(defaultProbePeriodSeconds),
+		FailureThreshold:    to.Int32Ptr(defaultProbeFailureThreshold),
+		SuccessThreshold:    to.Int32Ptr(defaultProbeSuccessThreshold),
+		TimeoutSeconds:      to.Int32Ptr(defaultProbeTimeoutSeconds),
+	}
+
+	if params.InitialDelaySeconds != nil {
+		probe.InitialDelaySeconds = params.InitialDelaySeconds
+	}
+	if params.PeriodSeconds != nil {
+		probe.PeriodSeconds = params.PeriodSeconds
+	}
+	if params.FailureThreshold != nil {
+		probe.FailureThreshold = params.FailureThreshold
+	}
+	if params.SuccessThreshold != nil {
+		probe.SuccessThreshold = params.SuccessThreshold
+	}
+	if params.TimeoutSeconds != nil {
+		probe.TimeoutSeconds = params.TimeoutSeconds
+	}
+
+	if len(params.Exec) > 0 {
+		if params.HTTPPath != nil || params.HTTPPort != nil {
+			return nil, fmt.Errorf("container probe cannot specify both exec and http")
+		}
+		command := make([]string, len(params.Exec))
+		copy(command, params.Exec)
+		probe.Exec = &containerinstance.ContainerExec{
+			Command: &command,
+		}
+		return probe, nil
+	}
+
+	port := params.HTTPPort
+	if port == nil {
+		for _, mapping := range portMappings {
+			if mapping.Protocol == containerinstance.TCP && mapping.Port != nil {
+				port = to.Int32Ptr(*mapping.Port)
+				break
+			}
+		}
+	}
+	if port == nil {
+		return nil, fmt.Errorf("container probe requires an exec command, an http port or a tcp ingress port")
+	}
+
+	path := params.HTTPPath
+	if path == nil {
+		path = to.StringPtr(defaultProbeHTTPPath)
+	}
+
+	scheme := containerinstance.HTTP
+	if params.HTTPScheme != nil {
+		switch strings.ToLower(*params.HTTPScheme) {
+		case string(containerinstance.HTTP):
+			scheme = containerinstance.HTTP
+		case string(containerinstance.HTTPS):
+			scheme = containerinstance.HTTPS
+		default:
+			return nil, fmt.Errorf("unsupported container probe scheme: %s", *params.HTTPScheme)
+		}
+	}
+
+	probe.HTTPGet = &containerinstance.ContainerHTTPGet{
+		Path:   path,
+		Port:   port,
+		Scheme: scheme,
+	}
+
+	return probe, nil
+}
+
+// containerProbeFailures returns the probe failures found in the instance view events of each container in the group
+func containerProbeFailures(containerGroup containerinstance.ContainerGroup) []*ContainerProbeFailure {
+	failures := make([]*ContainerProbeFailure, 0)
+	if containerGroup.ContainerGroupProperties == nil || containerGroup.Containers == nil {
+		return failures
+	}
+
+	for _, container := range *containerGroup.Containers {
+		if container.ContainerProperties == nil || container.InstanceView == nil || container.InstanceView.Events == nil {
+			continue
+		}
+
+		for _, event := range *container.InstanceView.Events {
+			if event.Message == nil {
+				continue
+			}
+
+			msg := strings.ToLower(*event.Message)
+			var probe string
+			if strings.HasPrefix(msg, "liveness probe failed") {
+				probe = containerProbeLiveness
+			} else if strings.HasPrefix(msg, "readiness probe failed") {
+				probe = containerProbeReadiness
+			} else {
+				continue
+			}
+
+			failures = append(failures, &ContainerProbeFailure{
+				ContainerName:  to.String(container.Name),
+				Probe:          probe,
+				Count:          to.Int32(event.Count),
+				Message:        *event.Message,
+				FirstTimestamp: dateTime(event.FirstTimestamp),
+				LastTimestamp:  dateTime(event.LastTimestamp),
+			})
+		}
+	}
+
+	return failures
+}
+
+// ContainerProbeFailures returns the liveness and readiness probe failures reported by the containers in the given group
+func ContainerProbeFailures(ctx context.Context, tc *provide.TargetCredentials, resourceGroupName, containerGroupName string) ([]*ContainerProbeFailure, error) {
+	containerGroup, err := GetContainerGroup(ctx, tc, resourceGroupName, containerGroupName)
+	if err != nil {
+		return nil, err
+	}
+
+	return containerProbeFailures(containerGroup), nil
+}
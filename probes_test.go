@@ -0,0 +1,102 @@
+package azurewrapper
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/containerinstance/mgmt/2018-10-01/containerinstance"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+func TestContainerProbeDefaultsToFirstTCPIngressPort(t *testing.T) {
+	portMappings := []containerinstance.Port{
+		{Port: to.Int32Ptr(30303), Protocol: containerinstance.UDP},
+		{Port: to.Int32Ptr(8080), Protocol: containerinstance.TCP},
+		{Port: to.Int32Ptr(8443), Protocol: containerinstance.TCP},
+	}
+
+	probe, err := containerProbe(&ContainerProbeParams{}, portMappings)
+	if err != nil {
+		t.Fatalf("failed to build container probe; %s", err.Error())
+	}
+	if probe.HTTPGet == nil {
+		t.Fatalf("expected http probe")
+	}
+	if *probe.HTTPGet.Port != 8080 {
+		t.Errorf("expected probe port 8080; got %d", *probe.HTTPGet.Port)
+	}
+	if *probe.HTTPGet.Path != defaultProbeHTTPPath {
+		t.Errorf("expected probe path %s; got %s", defaultProbeHTTPPath, *probe.HTTPGet.Path)
+	}
+	if *probe.PeriodSeconds != defaultProbePeriodSeconds {
+		t.Errorf("expected default probe period; got %d", *probe.PeriodSeconds)
+	}
+}
+
+func TestContainerProbeExec(t *testing.T) {
+	probe, err := containerProbe(&ContainerProbeParams{
+		Exec:          []string{"cat", "/tmp/healthy"},
+		PeriodSeconds: to.Int32Ptr(30),
+	}, nil)
+	if err != nil {
+		t.Fatalf("failed to build container probe; %s", err.Error())
+	}
+	if probe.HTTPGet != nil {
+		t.Errorf("expected exec probe only")
+	}
+	if len(*probe.Exec.Command) != 2 {
+		t.Errorf("expected exec command to be preserved")
+	}
+	if *probe.PeriodSeconds != 30 {
+		t.Errorf("expected probe period 30; got %d", *probe.PeriodSeconds)
+	}
+}
+
+func TestContainerProbeRequiresPort(t *testing.T) {
+	_, err := containerProbe(&ContainerProbeParams{}, []containerinstance.Port{
+		{Port: to.Int32Ptr(30303), Protocol: containerinstance.UDP},
+	})
+	if err == nil {
+		t.Errorf("expected error when no tcp ingress port is available")
+	}
+
+	_, err = containerProbe(&ContainerProbeParams{
+		Exec:     []string{"true"},
+		HTTPPort: to.Int32Ptr(8080),
+	}, nil)
+	if err == nil {
+		t.Errorf("expected error when both exec and http are given")
+	}
+}
+
+func TestContainerProbeFailures(t *testing.T) {
+	events := []containerinstance.Event{
+		{Name: to.StringPtr("Pulled"), Message: to.StringPtr("Successfully pulled image")},
+		{Name: to.StringPtr("Unhealthy"), Count: to.Int32Ptr(3), Message: to.StringPtr("Liveness probe failed: HTTP probe failed with statuscode: 500")},
+		{Name: to.StringPtr("Unhealthy"), Count: to.Int32Ptr(1), Message: to.StringPtr("Readiness probe failed: connection refused")},
+	}
+	containerGroup := containerinstance.ContainerGroup{
+		ContainerGroupProperties: &containerinstance.ContainerGroupProperties{
+			Containers: &[]containerinstance.Container{
+				{
+					Name: to.StringPtr("node"),
+					ContainerProperties: &containerinstance.ContainerProperties{
+						InstanceView: &containerinstance.ContainerPropertiesInstanceView{
+							Events: &events,
+						},
+					},
+				},
+			},
+		},
+	}
+
+	failures := containerProbeFailures(containerGroup)
+	if len(failures) != 2 {
+		t.Fatalf("expected 2 probe failures; got %d", len(failures))
+	}
+	if failures[0].Probe != containerProbeLiveness || failures[0].Count != 3 {
+		t.Errorf("expected liveness probe failure with count 3; got %+v", failures[0])
+	}
+	if failures[1].Probe != containerProbeReadiness || failures[1].ContainerName != "node" {
+		t.Errorf("expected readiness probe failure for node; got %+v", failures[1])
+	}
+}
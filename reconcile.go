@@ -0,0 +1,408 @@
+package azurewrapper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/containerinstance/mgmt/2018-10-01/containerinstance"
+	"github.com/Azure/go-autorest/autorest/to"
+
+	provide "github.com/provideplatform/provide-go/api/c2"
+)
+
+// ContainerGroupReconcileAction describes what is required to converge an existing container group on the desired spec
+type ContainerGroupReconcileAction string
+
+const (
+	// ContainerGroupReconcileNoop indicates the existing container group already matches the desired spec
+	ContainerGroupReconcileNoop ContainerGroupReconcileAction = "noop"
+
+	// ContainerGroupReconcileCreate indicates the container group does not exist
+	ContainerGroupReconcileCreate ContainerGroupReconcileAction = "create"
+
+	// ContainerGroupReconcileUpdate indicates the container group can be updated in place
+	ContainerGroupReconcileUpdate ContainerGroupReconcileAction = "update"
+
+	// ContainerGroupReconcileRecreate indicates the container group must be deleted and recreated
+	ContainerGroupReconcileRecreate ContainerGroupReconcileAction = "recreate"
+)
+
+// ContainerGroupReconcileResult is a struct representing the outcome of EnsureContainerGroup
+type ContainerGroupReconcileResult struct {
+	Action  ContainerGroupReconcileAction
+	Changes []string
+	Applied bool
+	Result  *provide.ContainerCreateResult
+
+	// Region is the region in which a created container group was placed when regions are given in the options
+	Region string
+}
+
+// EnsureContainerGroup converges the container group described by the given params on the desired spec;
+// groups which cannot be updated in place are only recreated when `allowRecreate` is true. The regions given
+// in the options are only used to place container groups which do not exist
+func EnsureContainerGroup(ctx context.Context, cp *provide.ContainerParams, tc *provide.TargetCredentials, opts *ContainerOptions, allowRecreate bool) (*ContainerGroupReconcileResult, error) {
+	if cp.ContainerGroupName == nil {
+		return nil, fmt.Errorf("Unable to ensure container group in region: %s; container group name is required", cp.Region)
+	}
+
+	cgClient, err := NewContainerGroupsClient(tc)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get container group client: %s; ", err.Error())
+	}
+
+	existing, err := cgClient.Get(ctx, cp.ResourceGroupName, *cp.ContainerGroupName)
+	if err != nil && !existing.HasHTTPStatus(http.StatusNotFound) {
+		return nil, fmt.Errorf("Unable to get container group: %s; ", err.Error())
+	}
+	exists := err == nil
+
+	reconcileResult := &ContainerGroupReconcileResult{
+		Action:  ContainerGroupReconcileCreate,
+		Changes: []string{},
+	}
+
+	if !exists && opts != nil && len(opts.Regions) > 0 {
+		placement, err := StartContainerWithPlacement(ctx, cp, tc, opts)
+		if err != nil {
+			return reconcileResult, err
+		}
+		reconcileResult.Result = placement.Result
+		reconcileResult.Region = placement.Region
+		reconcileResult.Applied = true
+		return reconcileResult, nil
+	}
+
+	desiredParams := *cp
+	desiredOpts := &ContainerOptions{}
+	if opts != nil {
+		*desiredOpts = *opts
+	}
+	desiredOpts.Regions = nil
+	if exists && opts != nil && len(opts.Regions) > 0 {
+		// an existing container group remains in its region when the region is acceptable
+		for _, region := range opts.Regions {
+			if normalizeRegion(region) == normalizeRegion(to.String(existing.Location)) {
+				desiredParams.Region = region
+				break
+			}
+		}
+	}
+
+	loadContainerRegionResourceLimits(ctx, tc, &desiredParams)
+	desired, err := containerGroupFromParams(&desiredParams, tc, desiredOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	if exists {
+		if desiredOpts.DNSNameLabelReusePolicy == DNSNameLabelReusePolicyNoReuse {
+			retainDNSNameLabel(existing, desired)
+		}
+		existingInitContainers, err := getContainerGroupInitContainers(ctx, cgClient, cp.ResourceGroupName, *cp.ContainerGroupName)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to get init containers of container group: %s; ", err.Error())
+		}
+		reconcileResult.Action, reconcileResult.Changes = diffContainerGroup(existing, *desired, existingInitContainers, initContainerDefinitions(desiredOpts.InitContainers))
+	}
+
+	switch reconcileResult.Action {
+	case ContainerGroupReconcileNoop:
+		reconcileResult.Result = containerCreateResult(existing)
+		return reconcileResult, nil
+	case ContainerGroupReconcileRecreate:
+		if !allowRecreate {
+			return reconcileResult, fmt.Errorf("container group %s requires recreate; changed: %s", *cp.ContainerGroupName, strings.Join(reconcileResult.Changes, ", "))
+		}
+
+		log.Debugf("recreating container group %s; changed: %s", *cp.ContainerGroupName, strings.Join(reconcileResult.Changes, ", "))
+		err = DeleteContainer(ctx, tc, cp.ResourceGroupName, *cp.ContainerGroupName)
+		if err != nil {
+			return reconcileResult, fmt.Errorf("failed to delete container group %s for recreate; %s", *cp.ContainerGroupName, err.Error())
+		}
+	}
+
+	err = preflightContainerGroupIfRequested(ctx, tc, &desiredParams, *desired, desiredOpts)
+	if err != nil {
+		return reconcileResult, err
+	}
+
+	// the desired spec which was diffed is applied as-is, so generated values such as DNS name labels match
+	reconcileResult.Result, _, err = deployContainerGroup(ctx, &desiredParams, tc, desiredOpts, *desired)
+	if err != nil {
+		return reconcileResult, err
+	}
+	reconcileResult.Applied = true
+
+	return reconcileResult, nil
+}
+
+// retainDNSNameLabel replaces the generated DNS name label of the desired container group with the label of the
+// existing container group, since labels generated without reuse never match and would otherwise never converge
+func retainDNSNameLabel(existing containerinstance.ContainerGroup, desired *containerinstance.ContainerGroup) {
+	if existing.ContainerGroupProperties == nil || existing.IPAddress == nil || existing.IPAddress.DNSNameLabel == nil {
+		return
+	}
+	if desired.ContainerGroupProperties == nil || desired.IPAddress == nil || desired.IPAddress.DNSNameLabel == nil {
+		return
+	}
+	desired.IPAddress.DNSNameLabel = existing.IPAddress.DNSNameLabel
+}
+
+// diffContainerGroup compares the existing container group and init containers with the desired spec and returns
+// the required action along with a description of each changed property
+func diffContainerGroup(existing, desired containerinstance.ContainerGroup, existingInitContainers, desiredInitContainers []initContainerDefinition) (ContainerGroupReconcileAction, []string) {
+	recreate := make([]string, 0)
+	update := make([]string, 0)
+
+	if normalizeRegion(to.String(existing.Location)) != normalizeRegion(to.String(desired.Location)) {
+		recreate = append(recreate, "location")
+	}
+
+	if !tagsEqual(existing.Tags, desired.Tags) {
+		update = append(update, "tags")
+	}
+
+	existingProps := existing.ContainerGroupProperties
+	if existingProps == nil {
+		existingProps = &containerinstance.ContainerGroupProperties{}
+	}
+	desiredProps := desired.ContainerGroupProperties
+
+	if !strings.EqualFold(string(existingProps.OsType), string(desiredProps.OsType)) {
+		recreate = append(recreate, "os type")
+	}
+
+	desiredRestartPolicy := desiredProps.RestartPolicy
+	if desiredRestartPolicy == "" {
+		desiredRestartPolicy = containerinstance.Always
+	}
+	if existingProps.RestartPolicy != "" && !strings.EqualFold(string(existingProps.RestartPolicy), string(desiredRestartPolicy)) {
+		recreate = append(recreate, "restart policy")
+	}
+
+	if !strings.EqualFold(containerGroupNetworkProfileID(existingProps), containerGroupNetworkProfileID(desiredProps)) {
+		recreate = append(recreate, "network profile")
+	}
+
+	var existingIP, desiredIP containerinstance.IPAddress
+	if existingProps.IPAddress != nil {
+		existingIP = *existingProps.IPAddress
+	}
+	if desiredProps.IPAddress != nil {
+		desiredIP = *desiredProps.IPAddress
+	}
+	if !strings.EqualFold(string(existingIP.Type), string(desiredIP.Type)) {
+		recreate = append(recreate, "ip address type")
+	}
+	if !strings.EqualFold(to.String(existingIP.DNSNameLabel), to.String(desiredIP.DNSNameLabel)) {
+		update = append(update, "dns name label")
+	}
+	if !equalStringSets(groupPortKeys(existingIP.Ports), groupPortKeys(desiredIP.Ports)) {
+		update = append(update, "ports")
+	}
+
+	if !equalStringSets(volumeKeys(existingProps.Volumes), volumeKeys(desiredProps.Volumes)) {
+		update = append(update, "volumes")
+	}
+
+	existingContainers := map[string]containerinstance.Container{}
+	if existingProps.Containers != nil {
+		for _, container := range *existingProps.Containers {
+			existingContainers[to.String(container.Name)] = container
+		}
+	}
+
+	desiredContainerCount := 0
+	if desiredProps.Containers != nil {
+		desiredContainerCount = len(*desiredProps.Containers)
+		for _, container := range *desiredProps.Containers {
+			name := to.String(container.Name)
+			current, currentOk := existingContainers[name]
+			if !currentOk || current.ContainerProperties == nil {
+				recreate = append(recreate, fmt.Sprintf("container %s added", name))
+				continue
+			}
+			containerRecreate, containerUpdate := diffContainer(name, *current.ContainerProperties, *container.ContainerProperties)
+			recreate = append(recreate, containerRecreate...)
+			update = append(update, containerUpdate...)
+		}
+	}
+	if len(existingContainers) > desiredContainerCount {
+		recreate = append(recreate, "containers removed")
+	}
+
+	initRecreate, initUpdate := diffInitContainers(existingInitContainers, desiredInitContainers)
+	recreate = append(recreate, initRecreate...)
+	update = append(update, initUpdate...)
+
+	if len(recreate) > 0 {
+		return ContainerGroupReconcileRecreate, append(recreate, update...)
+	}
+	if len(update) > 0 {
+		return ContainerGroupReconcileUpdate, update
+	}
+	return ContainerGroupReconcileNoop, []string{}
+}
+
+// diffContainer compares an existing container with the desired container and returns the
+// changed properties which require recreate and those which can be updated in place
+func diffContainer(name string, existing, desired containerinstance.ContainerProperties) (recreate, update []string) {
+	recreate = make([]string, 0)
+	update = make([]string, 0)
+
+	if !resourceRequirementsEqual(existing.Resources, desired.Resources) {
+		recreate = append(recreate, fmt.Sprintf("container %s resources", name))
+	}
+	if to.String(existing.Image) != to.String(desired.Image) {
+		update = append(update, fmt.Sprintf("container %s image", name))
+	}
+	if !equalStringSets(environmentKeys(existing.EnvironmentVariables), environmentKeys(desired.EnvironmentVariables)) {
+		update = append(update, fmt.Sprintf("container %s environment", name))
+	}
+	if !equalStringSets(containerPortKeys(existing.Ports), containerPortKeys(desired.Ports)) {
+		update = append(update, fmt.Sprintf("container %s ports", name))
+	}
+	if !jsonEqual(existing.LivenessProbe, desired.LivenessProbe) {
+		update = append(update, fmt.Sprintf("container %s liveness probe", name))
+	}
+	if !jsonEqual(existing.ReadinessProbe, desired.ReadinessProbe) {
+		update = append(update, fmt.Sprintf("container %s readiness probe", name))
+	}
+	if !jsonEqual(existing.VolumeMounts, desired.VolumeMounts) && !(isEmptyVolumeMounts(existing.VolumeMounts) && isEmptyVolumeMounts(desired.VolumeMounts)) {
+		update = append(update, fmt.Sprintf("container %s volume mounts", name))
+	}
+
+	return recreate, update
+}
+
+func resourceRequirementsEqual(existing, desired *containerinstance.ResourceRequirements) bool {
+	if existing == nil || desired == nil {
+		return existing == desired
+	}
+
+	var existingRequests, desiredRequests containerinstance.ResourceRequests
+	if existing.Requests != nil {
+		existingRequests = *existing.Requests
+	}
+	if desired.Requests != nil {
+		desiredRequests = *desired.Requests
+	}
+	if to.Float64(existingRequests.CPU) != to.Float64(desiredRequests.CPU) || to.Float64(existingRequests.MemoryInGB) != to.Float64(desiredRequests.MemoryInGB) {
+		return false
+	}
+
+	var existingLimits, desiredLimits containerinstance.ResourceLimits
+	if existing.Limits != nil {
+		existingLimits = *existing.Limits
+	}
+	if desired.Limits != nil {
+		desiredLimits = *desired.Limits
+	}
+	return to.Float64(existingLimits.CPU) == to.Float64(desiredLimits.CPU) && to.Float64(existingLimits.MemoryInGB) == to.Float64(desiredLimits.MemoryInGB)
+}
+
+func tagsEqual(a, b map[string]*string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		other, otherOk := b[k]
+		if !otherOk || to.String(v) != to.String(other) {
+			return false
+		}
+	}
+	return true
+}
+
+func environmentKeys(env *[]containerinstance.EnvironmentVariable) []string {
+	keys := make([]string, 0)
+	if env != nil {
+		for _, v := range *env {
+			keys = append(keys, fmt.Sprintf("%s=%s", to.String(v.Name), to.String(v.Value)))
+		}
+	}
+	return keys
+}
+
+func groupPortKeys(ports *[]containerinstance.Port) []string {
+	keys := make([]string, 0)
+	if ports != nil {
+		for _, port := range *ports {
+			keys = append(keys, fmt.Sprintf("%s/%d", strings.ToLower(string(port.Protocol)), to.Int32(port.Port)))
+		}
+	}
+	return keys
+}
+
+func containerPortKeys(ports *[]containerinstance.ContainerPort) []string {
+	keys := make([]string, 0)
+	if ports != nil {
+		for _, port := range *ports {
+			keys = append(keys, fmt.Sprintf("%d", to.Int32(port.Port)))
+		}
+	}
+	return keys
+}
+
+func equalStringSets(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	x := append([]string{}, a...)
+	y := append([]string{}, b...)
+	sort.Strings(x)
+	sort.Strings(y)
+	for i := range x {
+		if x[i] != y[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// containerGroupNetworkProfileID returns the ID of the network profile of the container group, or an empty string
+// when it is not deployed into a subnet; ARM normalizes the casing of resource IDs, so they compare case-insensitively
+func containerGroupNetworkProfileID(properties *containerinstance.ContainerGroupProperties) string {
+	if properties == nil || properties.NetworkProfile == nil {
+		return ""
+	}
+	return to.String(properties.NetworkProfile.ID)
+}
+
+// volumeKeys identifies volumes by name and source, since secrets and storage account keys are not returned by Azure
+func volumeKeys(volumes *[]containerinstance.Volume) []string {
+	keys := make([]string, 0)
+	if volumes != nil {
+		for _, volume := range *volumes {
+			source := "emptydir"
+			if volume.AzureFile != nil {
+				source = fmt.Sprintf("azurefile:%s/%s", to.String(volume.AzureFile.StorageAccountName), to.String(volume.AzureFile.ShareName))
+			} else if volume.GitRepo != nil {
+				source = fmt.Sprintf("gitrepo:%s@%s", to.String(volume.GitRepo.Repository), to.String(volume.GitRepo.Revision))
+			} else if volume.Secret != nil {
+				source = "secret"
+			}
+			keys = append(keys, fmt.Sprintf("%s:%s", to.String(volume.Name), source))
+		}
+	}
+	return keys
+}
+
+func isEmptyVolumeMounts(volumeMounts *[]containerinstance.VolumeMount) bool {
+	return volumeMounts == nil || len(*volumeMounts) == 0
+}
+
+func jsonEqual(a, b interface{}) bool {
+	x, _ := json.Marshal(a)
+	y, _ := json.Marshal(b)
+	return string(x) == string(y)
+}
+
+func normalizeRegion(region string) string {
+	return strings.ToLower(strings.Replace(region, " ", "", -1))
+}
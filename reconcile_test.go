@@ -0,0 +1,129 @@
+package azurewrapper
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/containerinstance/mgmt/2018-10-01/containerinstance"
+	"github.com/Azure/go-autorest/autorest/to"
+
+	provide "github.com/provideplatform/provide-go/api/c2"
+)
+
+func reconcileTestParams() *provide.ContainerParams {
+	return &provide.ContainerParams{
+		Region:             "eastus",
+		ResourceGroupName:  "skynet",
+		Image:              to.StringPtr("provide/nats-server:latest"),
+		ContainerGroupName: to.StringPtr("nats"),
+		CPU:                to.Int64Ptr(1),
+		Memory:             to.Int64Ptr(2),
+		Environment:        map[string]interface{}{"A": "1", "B": "2"},
+		Security: map[string]interface{}{
+			"ingress": map[string]interface{}{
+				"0.0.0.0/0": map[string]interface{}{
+					"tcp": []interface{}{float64(4222)},
+				},
+			},
+		},
+	}
+}
+
+// existingContainerGroup simulates the container group returned by Azure for the given desired spec
+func existingContainerGroup(t *testing.T, desired *containerinstance.ContainerGroup) containerinstance.ContainerGroup {
+	raw, _ := json.Marshal(desired)
+	var existing containerinstance.ContainerGroup
+	if err := json.Unmarshal(raw, &existing); err != nil {
+		t.Fatalf("failed to copy container group; %s", err.Error())
+	}
+	existing.Location = to.StringPtr("East US")
+	existing.RestartPolicy = containerinstance.Always
+	env := *(*existing.Containers)[0].EnvironmentVariables
+	env[0], env[1] = env[1], env[0]
+	return existing
+}
+
+func TestDiffContainerGroupNoop(t *testing.T) {
+	desired, err := containerGroupFromParams(reconcileTestParams(), tc, nil)
+	if err != nil {
+		t.Fatalf("failed to build container group; %s", err.Error())
+	}
+
+	action, changes := diffContainerGroup(existingContainerGroup(t, desired), *desired, nil, nil)
+	if action != ContainerGroupReconcileNoop {
+		t.Errorf("expected noop; got %s: %v", action, changes)
+	}
+}
+
+func TestDiffContainerGroupUpdate(t *testing.T) {
+	desired, _ := containerGroupFromParams(reconcileTestParams(), tc, nil)
+	existing := existingContainerGroup(t, desired)
+
+	params := reconcileTestParams()
+	params.Image = to.StringPtr("provide/nats-server:v2")
+	params.Environment["C"] = "3"
+	desired, _ = containerGroupFromParams(params, tc, nil)
+
+	action, changes := diffContainerGroup(existing, *desired, nil, nil)
+	if action != ContainerGroupReconcileUpdate {
+		t.Errorf("expected update; got %s", action)
+	}
+	if len(changes) != 2 {
+		t.Errorf("expected image and environment changes; got %v", changes)
+	}
+}
+
+func TestDiffContainerGroupRecreate(t *testing.T) {
+	desired, _ := containerGroupFromParams(reconcileTestParams(), tc, nil)
+	existing := existingContainerGroup(t, desired)
+
+	params := reconcileTestParams()
+	params.CPU = to.Int64Ptr(2)
+	desired, _ = containerGroupFromParams(params, tc, &ContainerOptions{RestartPolicy: containerinstance.Never})
+
+	action, changes := diffContainerGroup(existing, *desired, nil, nil)
+	if action != ContainerGroupReconcileRecreate {
+		t.Errorf("expected recreate; got %s", action)
+	}
+	if len(changes) != 2 {
+		t.Errorf("expected restart policy and resources changes; got %v", changes)
+	}
+}
+
+func TestDiffContainerGroupNetworkProfileCasing(t *testing.T) {
+	opts := &ContainerOptions{SubnetID: "/subscriptions/sub/resourceGroups/Network/providers/Microsoft.Network/virtualNetworks/vnet/subnets/containers"}
+	desired, err := containerGroupFromParams(reconcileTestParams(), tc, opts)
+	if err != nil {
+		t.Fatalf("failed to build container group; %s", err.Error())
+	}
+	existing := existingContainerGroup(t, desired)
+	existing.NetworkProfile.ID = to.StringPtr(strings.ToLower(to.String(desired.NetworkProfile.ID)))
+
+	action, changes := diffContainerGroup(existing, *desired, nil, nil)
+	if action != ContainerGroupReconcileNoop {
+		t.Errorf("expected network profile IDs differing in casing to be equal; got %s: %v", action, changes)
+	}
+
+	existing.NetworkProfile.ID = to.StringPtr(strings.Replace(to.String(desired.NetworkProfile.ID), "containers-profile", "jobs-profile", 1))
+	action, _ = diffContainerGroup(existing, *desired, nil, nil)
+	if action != ContainerGroupReconcileRecreate {
+		t.Errorf("expected another network profile to require recreate; got %s", action)
+	}
+}
+
+func TestDiffContainerGroupNoReuseDNSNameLabel(t *testing.T) {
+	opts := &ContainerOptions{DNSNameLabelReusePolicy: DNSNameLabelReusePolicyNoReuse}
+	desired, _ := containerGroupFromParams(reconcileTestParams(), tc, opts)
+	existing := existingContainerGroup(t, desired)
+
+	desired, _ = containerGroupFromParams(reconcileTestParams(), tc, opts)
+	if action, _ := diffContainerGroup(existing, *desired, nil, nil); action != ContainerGroupReconcileUpdate {
+		t.Errorf("expected regenerated DNS name label to differ; got %s", action)
+	}
+
+	retainDNSNameLabel(existing, desired)
+	if action, changes := diffContainerGroup(existing, *desired, nil, nil); action != ContainerGroupReconcileNoop {
+		t.Errorf("expected noop once the existing DNS name label is retained; got %s: %v", action, changes)
+	}
+}
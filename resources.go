@@ -0,0 +1,228 @@
+package azurewrapper
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/services/containerinstance/mgmt/2018-10-01/containerinstance"
+	"github.com/Azure/go-autorest/autorest/to"
+
+	provide "github.com/provideplatform/provide-go/api/c2"
+)
+
+const defaultContainerCPU = float64(1)
+const defaultContainerMemoryInGB = float64(1.5)
+
+// ContainerResourceLimits represents the maximum resources a single container group may request in a region
+type ContainerResourceLimits struct {
+	MaxCPU        float64
+	MaxMemoryInGB float64
+}
+
+// DefaultContainerResourceLimits are the ACI resource maximums applied to regions without registered limits
+var DefaultContainerResourceLimits = ContainerResourceLimits{
+	MaxCPU:        4,
+	MaxMemoryInGB: 16,
+}
+
+// containerRegionResourceLimits maps lowercase region names to ACI resource maximums which differ from the defaults
+var containerRegionResourceLimits = map[string]ContainerResourceLimits{}
+
+// containerRegionResourceLimitsLoaded records the regions whose capabilities have been requested, so a region is
+// queried at most once per process whether or not the capabilities could be retrieved
+var containerRegionResourceLimitsLoaded = map[string]bool{}
+
+var containerRegionResourceLimitsMutex sync.RWMutex
+
+// ContainerResources is a struct representing fractional CPU and memory requests and limits for a container;
+// nil requests fall back to the provider-neutral container params and then to the defaults, and nil limits fall
+// back to the requests
+type ContainerResources struct {
+	CPURequest        *float64
+	CPULimit          *float64
+	MemoryRequestInGB *float64
+	MemoryLimitInGB   *float64
+}
+
+// containerResourceLimits returns the resource maximums for the given region
+func containerResourceLimits(region string) ContainerResourceLimits {
+	containerRegionResourceLimitsMutex.RLock()
+	defer containerRegionResourceLimitsMutex.RUnlock()
+	if limits, limitsOk := containerRegionResourceLimits[strings.ToLower(region)]; limitsOk {
+		return limits
+	}
+	return DefaultContainerResourceLimits
+}
+
+// SetContainerRegionResourceLimits registers the resource maximums of the given region; registered limits take
+// precedence over the container capabilities API
+func SetContainerRegionResourceLimits(region string, limits ContainerResourceLimits) {
+	containerRegionResourceLimitsMutex.Lock()
+	defer containerRegionResourceLimitsMutex.Unlock()
+	containerRegionResourceLimits[strings.ToLower(region)] = limits
+}
+
+// ClearContainerRegionResourceLimits removes the registered resource maximums of the given region, restoring the
+// defaults until the capabilities of the region are loaded again
+func ClearContainerRegionResourceLimits(region string) {
+	containerRegionResourceLimitsMutex.Lock()
+	defer containerRegionResourceLimitsMutex.Unlock()
+	delete(containerRegionResourceLimits, strings.ToLower(region))
+	delete(containerRegionResourceLimitsLoaded, strings.ToLower(region))
+}
+
+// LoadContainerRegionResourceLimits registers the resource maximums of the given region using the container
+// capabilities API, unless limits are already registered for the region
+func LoadContainerRegionResourceLimits(ctx context.Context, tc *provide.TargetCredentials, region string) error {
+	containerRegionResourceLimitsMutex.RLock()
+	_, limitsOk := containerRegionResourceLimits[strings.ToLower(region)]
+	containerRegionResourceLimitsMutex.RUnlock()
+	if limitsOk {
+		return nil
+	}
+
+	capacity, err := GetContainerRegionCapacity(ctx, tc, region)
+	if err != nil {
+		return err
+	}
+
+	limits, limitsOk := containerResourceLimitsFromCapabilities(capacity.Capabilities)
+	if !limitsOk {
+		return fmt.Errorf("no container group capabilities in region: %s", region)
+	}
+
+	containerRegionResourceLimitsMutex.Lock()
+	defer containerRegionResourceLimitsMutex.Unlock()
+	if _, limitsOk := containerRegionResourceLimits[strings.ToLower(region)]; !limitsOk {
+		containerRegionResourceLimits[strings.ToLower(region)] = limits
+	}
+	return nil
+}
+
+// loadContainerRegionResourceLimits loads the resource maximums of the region of the given params the first time
+// a container group is deployed to the region; the defaults continue to be used if the capabilities cannot be
+// retrieved, since the deployment is validated by the region regardless, and the region is not queried again.
+// Params which cannot describe a container group are rejected by containerGroupFromParams instead
+func loadContainerRegionResourceLimits(ctx context.Context, tc *provide.TargetCredentials, cp *provide.ContainerParams) {
+	if cp.Image == nil || cp.ContainerGroupName == nil {
+		return
+	}
+
+	region := strings.ToLower(cp.Region)
+	containerRegionResourceLimitsMutex.Lock()
+	_, limitsOk := containerRegionResourceLimits[region]
+	loaded := containerRegionResourceLimitsLoaded[region]
+	containerRegionResourceLimitsLoaded[region] = true
+	containerRegionResourceLimitsMutex.Unlock()
+	if limitsOk || loaded {
+		return
+	}
+
+	err := LoadContainerRegionResourceLimits(ctx, tc, cp.Region)
+	if err != nil {
+		log.Warningf("failed to load container resource limits for region %s; using defaults; %s", cp.Region, err.Error())
+	}
+}
+
+// containerResourceLimitsFromCapabilities returns the greatest CPU and memory available to a container group
+// without GPUs of any OS type; the OS-specific maximums are enforced by the preflight
+func containerResourceLimitsFromCapabilities(capabilities []containerinstance.Capabilities) (ContainerResourceLimits, bool) {
+	limits := ContainerResourceLimits{}
+	limitsOk := false
+	for _, capability := range capabilities {
+		if !strings.EqualFold(to.String(capability.ResourceType), capabilityResourceTypeContainerGroups) {
+			continue
+		}
+		if capability.Gpu != nil && !strings.EqualFold(*capability.Gpu, capabilityGPUNone) {
+			continue
+		}
+		if capability.Capabilities == nil || capability.Capabilities.MaxCPU == nil || capability.Capabilities.MaxMemoryInGB == nil {
+			continue
+		}
+
+		limits.MaxCPU = math.Max(limits.MaxCPU, *capability.Capabilities.MaxCPU)
+		limits.MaxMemoryInGB = math.Max(limits.MaxMemoryInGB, *capability.Capabilities.MaxMemoryInGB)
+		limitsOk = true
+	}
+	return limits, limitsOk
+}
+
+// ContainerResourceLimitError is returned when the resources of a container exceed the maximum supported in its region
+type ContainerResourceLimitError struct {
+	Resource  string
+	Requested float64
+	Max       float64
+	Unit      string
+	Region    string
+}
+
+func (e *ContainerResourceLimitError) Error() string {
+	return fmt.Sprintf("invalid %s: %v%s; exceeds maximum of %v%s in region: %s", e.Resource, e.Requested, e.Unit, e.Max, e.Unit, e.Region)
+}
+
+// containerResourceRequirements resolves and validates the resource requirements for a container
+func containerResourceRequirements(cp *provide.ContainerParams, resources *ContainerResources) (*containerinstance.ResourceRequirements, error) {
+	cpuRequest := defaultContainerCPU
+	if cp.CPU != nil {
+		cpuRequest = float64(*cp.CPU)
+	}
+	memoryRequest := defaultContainerMemoryInGB
+	if cp.Memory != nil {
+		memoryRequest = float64(*cp.Memory)
+	}
+
+	if resources != nil {
+		if resources.CPURequest != nil {
+			cpuRequest = *resources.CPURequest
+		}
+		if resources.MemoryRequestInGB != nil {
+			memoryRequest = *resources.MemoryRequestInGB
+		}
+	}
+
+	cpuLimit := cpuRequest
+	memoryLimit := memoryRequest
+	if resources != nil {
+		if resources.CPULimit != nil {
+			cpuLimit = *resources.CPULimit
+		}
+		if resources.MemoryLimitInGB != nil {
+			memoryLimit = *resources.MemoryLimitInGB
+		}
+	}
+
+	if cpuRequest <= 0 {
+		return nil, fmt.Errorf("invalid cpu request: %v; must be greater than 0", cpuRequest)
+	}
+	if memoryRequest <= 0 {
+		return nil, fmt.Errorf("invalid memory request: %v GB; must be greater than 0", memoryRequest)
+	}
+	if cpuLimit < cpuRequest {
+		return nil, fmt.Errorf("invalid cpu limit: %v; must be at least the cpu request of %v", cpuLimit, cpuRequest)
+	}
+	if memoryLimit < memoryRequest {
+		return nil, fmt.Errorf("invalid memory limit: %v GB; must be at least the memory request of %v GB", memoryLimit, memoryRequest)
+	}
+
+	limits := containerResourceLimits(cp.Region)
+	if cpuLimit > limits.MaxCPU {
+		return nil, &ContainerResourceLimitError{Resource: "cpu", Requested: cpuLimit, Max: limits.MaxCPU, Region: cp.Region}
+	}
+	if memoryLimit > limits.MaxMemoryInGB {
+		return nil, &ContainerResourceLimitError{Resource: "memory", Requested: memoryLimit, Max: limits.MaxMemoryInGB, Unit: " GB", Region: cp.Region}
+	}
+
+	return &containerinstance.ResourceRequirements{
+		Limits: &containerinstance.ResourceLimits{
+			MemoryInGB: to.Float64Ptr(memoryLimit),
+			CPU:        to.Float64Ptr(cpuLimit),
+		},
+		Requests: &containerinstance.ResourceRequests{
+			MemoryInGB: to.Float64Ptr(memoryRequest),
+			CPU:        to.Float64Ptr(cpuRequest),
+		},
+	}, nil
+}
@@ -0,0 +1,103 @@
+package azurewrapper
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/containerinstance/mgmt/2018-10-01/containerinstance"
+	"github.com/Azure/go-autorest/autorest/to"
+
+	provide "github.com/provideplatform/provide-go/api/c2"
+)
+
+func TestContainerResourceRequirementsDefaults(t *testing.T) {
+	requirements, err := containerResourceRequirements(&provide.ContainerParams{Region: "eastus"}, nil)
+	if err != nil {
+		t.Fatalf("failed to resolve resource requirements; %s", err.Error())
+	}
+	if *requirements.Requests.CPU != defaultContainerCPU || *requirements.Limits.CPU != defaultContainerCPU {
+		t.Errorf("expected default cpu; got %+v", requirements)
+	}
+	if *requirements.Requests.MemoryInGB != defaultContainerMemoryInGB || *requirements.Limits.MemoryInGB != defaultContainerMemoryInGB {
+		t.Errorf("expected default memory; got %+v", requirements)
+	}
+}
+
+func TestContainerResourceRequirementsFractional(t *testing.T) {
+	cp := &provide.ContainerParams{
+		Region: "eastus",
+		CPU:    to.Int64Ptr(2),
+		Memory: to.Int64Ptr(4),
+	}
+	requirements, err := containerResourceRequirements(cp, &ContainerResources{
+		CPURequest:        to.Float64Ptr(0.5),
+		CPULimit:          to.Float64Ptr(1),
+		MemoryRequestInGB: to.Float64Ptr(1.5),
+	})
+	if err != nil {
+		t.Fatalf("failed to resolve resource requirements; %s", err.Error())
+	}
+	if *requirements.Requests.CPU != 0.5 || *requirements.Limits.CPU != 1 {
+		t.Errorf("expected cpu request 0.5 and limit 1; got %v and %v", *requirements.Requests.CPU, *requirements.Limits.CPU)
+	}
+	if *requirements.Requests.MemoryInGB != 1.5 || *requirements.Limits.MemoryInGB != 1.5 {
+		t.Errorf("expected memory request and limit 1.5; got %v and %v", *requirements.Requests.MemoryInGB, *requirements.Limits.MemoryInGB)
+	}
+}
+
+func TestContainerResourceRequirementsValidation(t *testing.T) {
+	cp := &provide.ContainerParams{Region: "eastus"}
+
+	_, err := containerResourceRequirements(cp, &ContainerResources{CPURequest: to.Float64Ptr(2), CPULimit: to.Float64Ptr(1)})
+	if err == nil {
+		t.Errorf("expected error when cpu limit is below request")
+	}
+
+	_, err = containerResourceRequirements(cp, &ContainerResources{MemoryRequestInGB: to.Float64Ptr(0)})
+	if err == nil {
+		t.Errorf("expected error for zero memory request")
+	}
+
+	_, err = containerResourceRequirements(cp, &ContainerResources{CPURequest: to.Float64Ptr(DefaultContainerResourceLimits.MaxCPU + 1)})
+	if err == nil {
+		t.Errorf("expected error when cpu exceeds regional maximum")
+	}
+
+	SetContainerRegionResourceLimits("testregion", ContainerResourceLimits{MaxCPU: 1, MaxMemoryInGB: 2})
+	defer ClearContainerRegionResourceLimits("testregion")
+	_, err = containerResourceRequirements(&provide.ContainerParams{Region: "TestRegion"}, &ContainerResources{MemoryRequestInGB: to.Float64Ptr(3)})
+	if err == nil {
+		t.Errorf("expected error when memory exceeds registered regional maximum")
+	}
+}
+
+func TestContainerResourceLimitsFromCapabilities(t *testing.T) {
+	capabilities := []containerinstance.Capabilities{
+		{
+			ResourceType: to.StringPtr("containerGroups"),
+			OsType:       to.StringPtr("Linux"),
+			Gpu:          to.StringPtr("None"),
+			Capabilities: &containerinstance.CapabilitiesCapabilities{MaxCPU: to.Float64Ptr(4), MaxMemoryInGB: to.Float64Ptr(16)},
+		},
+		{
+			ResourceType: to.StringPtr("containerGroups"),
+			OsType:       to.StringPtr("Windows"),
+			Gpu:          to.StringPtr("None"),
+			Capabilities: &containerinstance.CapabilitiesCapabilities{MaxCPU: to.Float64Ptr(2), MaxMemoryInGB: to.Float64Ptr(8)},
+		},
+		{
+			ResourceType: to.StringPtr("containerGroups"),
+			OsType:       to.StringPtr("Linux"),
+			Gpu:          to.StringPtr("K80"),
+			Capabilities: &containerinstance.CapabilitiesCapabilities{MaxCPU: to.Float64Ptr(24), MaxMemoryInGB: to.Float64Ptr(448)},
+		},
+	}
+
+	limits, limitsOk := containerResourceLimitsFromCapabilities(capabilities)
+	if !limitsOk || limits.MaxCPU != 4 || limits.MaxMemoryInGB != 16 {
+		t.Errorf("expected the greatest limits of container groups without GPUs; got %+v", limits)
+	}
+
+	if _, limitsOk := containerResourceLimitsFromCapabilities(capabilities[2:]); limitsOk {
+		t.Errorf("expected no limits without container group capabilities")
+	}
+}
@@ -0,0 +1,622 @@
+package azurewrapper
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-12-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+
+	provide "github.com/provideplatform/provide-go/api/c2"
+)
+
+const ingressSecurityRulePriorityStart = int32(100)
+const egressSecurityRulePriorityStart = int32(100)
+const securityRulePriorityMax = int32(4096)
+
+// egressDenyAllRuleName is the name of the lowest priority custom outbound rule which denies all egress
+// which is not explicitly allowed; it takes precedence over the default AllowVnetOutBound and AllowInternetOutBound rules
+const egressDenyAllRuleName = "deny-egress-all"
+
+// ingressDenyAllRuleName is the name of the lowest priority custom inbound rule which denies all ingress which is
+// not explicitly allowed; it takes precedence over the default AllowVnetInBound and AllowAzureLoadBalancerInBound rules
+const ingressDenyAllRuleName = "deny-ingress-all"
+
+// ingressLoadBalancerRuleName is the name of the inbound rule which keeps admitting the Azure load balancer health
+// probes, which would otherwise be denied by the deny-all ingress rule
+const ingressLoadBalancerRuleName = "allow-ingress-azure-load-balancer"
+
+// IngressSourceRestrictionError is returned when the ingress security config restricts source CIDRs
+// but the target resource cannot enforce source restrictions; the ports are never exposed in this case
+type IngressSourceRestrictionError struct {
+	Target string
+	CIDRs  []string
+}
+
+func (e *IngressSourceRestrictionError) Error() string {
+	return fmt.Sprintf("%s cannot enforce ingress source restrictions: %s; enforce them using a network security group on the subnet or network interface", e.Target, strings.Join(e.CIDRs, ", "))
+}
+
+// SubnetSecurityGroupConflictError is returned when a network security group is associated with a subnet which
+// already has a different network security group and replacing it was not requested
+type SubnetSecurityGroupConflictError struct {
+	SubnetName      string
+	SecurityGroupID string
+}
+
+func (e *SubnetSecurityGroupConflictError) Error() string {
+	return fmt.Sprintf("subnet %s is already associated with network security group %s", e.SubnetName, e.SecurityGroupID)
+}
+
+// SecurityPolicyConflictError is returned when the security policy of a container group would replace the rules of
+// the network security group of its subnet while other container groups which rely on those rules remain in the subnet
+type SecurityPolicyConflictError struct {
+	SecurityGroupID   string
+	ContainerGroupIDs []string
+}
+
+func (e *SecurityPolicyConflictError) Error() string {
+	return fmt.Sprintf("security policy conflicts with the rules of network security group %s which are in use by container groups: %s; deploy into another subnet or use the same security policy", e.SecurityGroupID, strings.Join(e.ContainerGroupIDs, ", "))
+}
+
+// EgressRestrictionError is returned when the security config restricts egress but the target resource
+// is not deployed into a subnet on which outbound restrictions can be enforced
+type EgressRestrictionError struct {
+	Target string
+}
+
+func (e *EgressRestrictionError) Error() string {
+	return fmt.Sprintf("%s cannot enforce egress restrictions; enforce them using a network security group on the subnet", e.Target)
+}
+
+// UpsertSecurityGroup creates or updates a network security group which allows inbound traffic only from the
+// CIDRs and to the ports given in the ingress rules of the security policy; unless egress is unrestricted,
+// outbound traffic is denied except to the CIDRs, service tags and ports given in the egress rules
+func UpsertSecurityGroup(ctx context.Context, tc *provide.TargetCredentials, groupName, name, region string, policy *SecurityPolicy, tags map[string]string) (*network.SecurityGroup, error) {
+	err := policy.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("cannot create network security group: %v", err)
+	}
+
+	rules, err := securityPolicyRules(policy)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create network security group: %v", err)
+	}
+
+	nsgTags, err := resourceTags(tags)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create network security group: %v", err)
+	}
+
+	existing, err := getSecurityGroup(ctx, tc, groupName, name)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create network security group: %v", err)
+	}
+	if existing != nil {
+		nsgTags, err = upsertedResourceTags(nsgTags, existing.Tags, true)
+	} else {
+		nsgTags, err = upsertedResourceTags(nsgTags, nil, false)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot create network security group: %v", err)
+	}
+
+	nsgClient, err := NewSecurityGroupsClient(tc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create network security group client; %s", err.Error())
+	}
+
+	future, err := nsgClient.CreateOrUpdate(ctx, groupName, name, network.SecurityGroup{
+		Location: to.StringPtr(region),
+		Tags:     nsgTags,
+		SecurityGroupPropertiesFormat: &network.SecurityGroupPropertiesFormat{
+			SecurityRules: &rules,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot create network security group: %v", err)
+	}
+
+	err = future.WaitForCompletionRef(ctx, nsgClient.Client)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get the network security group create or update future response: %v", err)
+	}
+
+	nsg, err := future.Result(nsgClient)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create network security group; %s", err.Error())
+	}
+
+	return &nsg, nil
+}
+
+// AssociateSubnetSecurityGroup associates the given network security group with the given subnet; when the subnet
+// is already associated with a different network security group, a SubnetSecurityGroupConflictError is returned
+// unless replace is true
+func AssociateSubnetSecurityGroup(ctx context.Context, tc *provide.TargetCredentials, groupName, virtualNetworkName, subnetName, securityGroupID string, replace bool) (*network.Subnet, error) {
+	subnetClient, err := NewSubnetsClient(tc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create subnet client; %s", err.Error())
+	}
+
+	subnet, err := subnetClient.Get(ctx, groupName, virtualNetworkName, subnetName, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get subnet %s; %s", subnetName, err.Error())
+	}
+	if subnet.SubnetPropertiesFormat == nil {
+		subnet.SubnetPropertiesFormat = &network.SubnetPropertiesFormat{}
+	}
+	if err := subnetSecurityGroupConflict(subnet, securityGroupID, replace); err != nil {
+		return nil, err
+	}
+	subnet.NetworkSecurityGroup = &network.SecurityGroup{ID: to.StringPtr(securityGroupID)}
+
+	future, err := subnetClient.CreateOrUpdate(ctx, groupName, virtualNetworkName, subnetName, subnet)
+	if err != nil {
+		return nil, fmt.Errorf("cannot associate network security group with subnet: %v", err)
+	}
+
+	err = future.WaitForCompletionRef(ctx, subnetClient.Client)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get the subnet create or update future response: %v", err)
+	}
+
+	subnet, err = future.Result(subnetClient)
+	if err != nil {
+		return nil, fmt.Errorf("failed to associate network security group with subnet; %s", err.Error())
+	}
+
+	return &subnet, nil
+}
+
+// AssociateNetworkInterfaceSecurityGroup associates the given network security group with the given network interface
+func AssociateNetworkInterfaceSecurityGroup(ctx context.Context, tc *provide.TargetCredentials, groupName, networkInterfaceName, securityGroupID string) (*network.Interface, error) {
+	nicClient, err := NewInterfacesClient(tc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create network interface client; %s", err.Error())
+	}
+
+	nic, err := nicClient.Get(ctx, groupName, networkInterfaceName, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get network interface %s; %s", networkInterfaceName, err.Error())
+	}
+	if nic.InterfacePropertiesFormat == nil {
+		nic.InterfacePropertiesFormat = &network.InterfacePropertiesFormat{}
+	}
+	nic.NetworkSecurityGroup = &network.SecurityGroup{ID: to.StringPtr(securityGroupID)}
+
+	future, err := nicClient.CreateOrUpdate(ctx, groupName, networkInterfaceName, nic)
+	if err != nil {
+		return nil, fmt.Errorf("cannot associate network security group with network interface: %v", err)
+	}
+
+	err = future.WaitForCompletionRef(ctx, nicClient.Client)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get the network interface create or update future response: %v", err)
+	}
+
+	nic, err = future.Result(nicClient)
+	if err != nil {
+		return nil, fmt.Errorf("failed to associate network security group with network interface; %s", err.Error())
+	}
+
+	return &nic, nil
+}
+
+// EnforceSecurityPolicy upserts a network security group for the given subnet from the ingress and egress
+// rules of the security policy and associates it with the subnet; a network security group which is not
+// managed for the subnet is never replaced
+func EnforceSecurityPolicy(ctx context.Context, tc *provide.TargetCredentials, groupName, region, virtualNetworkName, subnetName string, policy *SecurityPolicy, tags map[string]string) (*network.SecurityGroup, error) {
+	nsg, err := UpsertSecurityGroup(ctx, tc, groupName, subnetSecurityGroupName(virtualNetworkName, subnetName), region, policy, tags)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = AssociateSubnetSecurityGroup(ctx, tc, groupName, virtualNetworkName, subnetName, to.String(nsg.ID), false)
+	if err != nil {
+		return nil, err
+	}
+
+	return nsg, nil
+}
+
+// getSecurityGroup returns the network security group with the given name, or nil if it does not exist
+func getSecurityGroup(ctx context.Context, tc *provide.TargetCredentials, groupName, name string) (*network.SecurityGroup, error) {
+	nsgClient, err := NewSecurityGroupsClient(tc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create network security group client; %s", err.Error())
+	}
+
+	nsg, err := nsgClient.Get(ctx, groupName, name, "")
+	if err != nil {
+		if isNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get network security group %s; %s", name, err.Error())
+	}
+
+	return &nsg, nil
+}
+
+// DeleteSecurityGroup dissociates the given network security group from its subnets and network interfaces and
+// deletes it; it returns the ID of the deleted network security group, or an empty string if it did not exist.
+// An UnmanagedResourceError is returned, and nothing is dissociated, when it was not created by this package
+func DeleteSecurityGroup(ctx context.Context, tc *provide.TargetCredentials, groupName, name string) (string, error) {
+	nsgClient, err := NewSecurityGroupsClient(tc)
+	if err != nil {
+		return "", fmt.Errorf("failed to create network security group client; %s", err.Error())
+	}
+
+	nsg, err := nsgClient.Get(ctx, groupName, name, "")
+	if err != nil {
+		if isNotFound(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to get network security group %s; %s", name, err.Error())
+	}
+	if !isManagedResource(nsg.Tags) {
+		return "", &UnmanagedResourceError{ResourceID: securityGroupResourceID(tc, groupName, name)}
+	}
+
+	if nsg.SecurityGroupPropertiesFormat != nil && nsg.Subnets != nil {
+		for _, subnet := range *nsg.Subnets {
+			err = dissociateSubnetSecurityGroup(ctx, tc, to.String(subnet.ID))
+			if err != nil {
+				return "", err
+			}
+		}
+	}
+	if nsg.SecurityGroupPropertiesFormat != nil && nsg.NetworkInterfaces != nil {
+		for _, nic := range *nsg.NetworkInterfaces {
+			err = dissociateNetworkInterfaceSecurityGroup(ctx, tc, to.String(nic.ID))
+			if err != nil {
+				return "", err
+			}
+		}
+	}
+
+	future, err := nsgClient.Delete(ctx, groupName, name)
+	if err != nil {
+		return "", fmt.Errorf("cannot delete network security group: %v", err)
+	}
+
+	err = future.WaitForCompletionRef(ctx, nsgClient.Client)
+	if err != nil {
+		return "", fmt.Errorf("cannot get the network security group delete future response: %v", err)
+	}
+
+	return to.String(nsg.ID), nil
+}
+
+// dissociateSubnetSecurityGroup removes the network security group from the subnet with the given ID
+func dissociateSubnetSecurityGroup(ctx context.Context, tc *provide.TargetCredentials, subnetID string) error {
+	subnetClient, err := NewSubnetsClient(tc)
+	if err != nil {
+		return fmt.Errorf("failed to create subnet client; %s", err.Error())
+	}
+
+	groupName := resourceIDSegment(subnetID, "resourceGroups")
+	virtualNetworkName := resourceIDSegment(subnetID, "virtualNetworks")
+	subnetName := resourceIDSegment(subnetID, "subnets")
+
+	subnet, err := subnetClient.Get(ctx, groupName, virtualNetworkName, subnetName, "")
+	if err != nil {
+		return fmt.Errorf("failed to get subnet %s; %s", subnetName, err.Error())
+	}
+	if subnet.SubnetPropertiesFormat == nil || subnet.NetworkSecurityGroup == nil {
+		return nil
+	}
+	subnet.NetworkSecurityGroup = nil
+
+	future, err := subnetClient.CreateOrUpdate(ctx, groupName, virtualNetworkName, subnetName, subnet)
+	if err != nil {
+		return fmt.Errorf("cannot dissociate network security group from subnet: %v", err)
+	}
+
+	err = future.WaitForCompletionRef(ctx, subnetClient.Client)
+	if err != nil {
+		return fmt.Errorf("cannot get the subnet create or update future response: %v", err)
+	}
+
+	return nil
+}
+
+// dissociateNetworkInterfaceSecurityGroup removes the network security group from the network interface with the given ID
+func dissociateNetworkInterfaceSecurityGroup(ctx context.Context, tc *provide.TargetCredentials, networkInterfaceID string) error {
+	nicClient, err := NewInterfacesClient(tc)
+	if err != nil {
+		return fmt.Errorf("failed to create network interface client; %s", err.Error())
+	}
+
+	groupName := resourceIDSegment(networkInterfaceID, "resourceGroups")
+	networkInterfaceName := resourceIDSegment(networkInterfaceID, "networkInterfaces")
+
+	nic, err := nicClient.Get(ctx, groupName, networkInterfaceName, "")
+	if err != nil {
+		return fmt.Errorf("failed to get network interface %s; %s", networkInterfaceName, err.Error())
+	}
+	if nic.InterfacePropertiesFormat == nil || nic.NetworkSecurityGroup == nil {
+		return nil
+	}
+	nic.NetworkSecurityGroup = nil
+
+	future, err := nicClient.CreateOrUpdate(ctx, groupName, networkInterfaceName, nic)
+	if err != nil {
+		return fmt.Errorf("cannot dissociate network security group from network interface: %v", err)
+	}
+
+	err = future.WaitForCompletionRef(ctx, nicClient.Client)
+	if err != nil {
+		return fmt.Errorf("cannot get the network interface create or update future response: %v", err)
+	}
+
+	return nil
+}
+
+// subnetSecurityGroupConflict returns a SubnetSecurityGroupConflictError if the subnet is associated with a network
+// security group other than the given one and replace is false
+func subnetSecurityGroupConflict(subnet network.Subnet, securityGroupID string, replace bool) error {
+	if replace || subnet.SubnetPropertiesFormat == nil || subnet.NetworkSecurityGroup == nil {
+		return nil
+	}
+	existingID := to.String(subnet.NetworkSecurityGroup.ID)
+	if existingID == "" || strings.EqualFold(existingID, securityGroupID) {
+		return nil
+	}
+	return &SubnetSecurityGroupConflictError{
+		SubnetName:      to.String(subnet.Name),
+		SecurityGroupID: existingID,
+	}
+}
+
+// securityGroupResourceID returns the ARM resource ID of the given network security group
+func securityGroupResourceID(tc *provide.TargetCredentials, groupName, name string) string {
+	return fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/networkSecurityGroups/%s", *tc.AzureSubscriptionID, groupName, name)
+}
+
+// subnetSecurityGroupName returns the name of the network security group managed for the given subnet
+func subnetSecurityGroupName(virtualNetworkName, subnetName string) string {
+	return fmt.Sprintf("%s-%s-nsg", virtualNetworkName, subnetName)
+}
+
+// isUnrestrictedCIDR returns true if the given ingress source matches any address
+func isUnrestrictedCIDR(cidr string) bool {
+	switch strings.TrimSpace(cidr) {
+	case "*", "0.0.0.0/0", "::/0", "Internet":
+		return true
+	}
+	return false
+}
+
+// securityPolicyRules converts the ingress and egress rules of the security policy into network security rules
+func securityPolicyRules(policy *SecurityPolicy) ([]network.SecurityRule, error) {
+	rules, err := ingressSecurityRules(policy)
+	if err != nil {
+		return nil, err
+	}
+
+	egressRules, err := egressSecurityRules(policy)
+	if err != nil {
+		return nil, err
+	}
+	return append(rules, egressRules...), nil
+}
+
+// securityRulesEqual returns true if the network security group has exactly the given rules, ignoring their
+// descriptions and the form in which their address prefixes and port ranges are given
+func securityRulesEqual(nsg *network.SecurityGroup, rules []network.SecurityRule) bool {
+	existing := make([]network.SecurityRule, 0)
+	if nsg != nil && nsg.SecurityGroupPropertiesFormat != nil && nsg.SecurityRules != nil {
+		existing = *nsg.SecurityRules
+	}
+	if len(existing) != len(rules) {
+		return false
+	}
+
+	keys := map[string]bool{}
+	for _, rule := range existing {
+		keys[securityRuleKey(rule)] = true
+	}
+	for _, rule := range rules {
+		if !keys[securityRuleKey(rule)] {
+			return false
+		}
+	}
+	return true
+}
+
+// securityRuleKey returns a normalized representation of the given rule for comparison
+func securityRuleKey(rule network.SecurityRule) string {
+	properties := rule.SecurityRulePropertiesFormat
+	if properties == nil {
+		return strings.ToLower(to.String(rule.Name))
+	}
+
+	return strings.ToLower(fmt.Sprintf("%s|%s|%s|%s|%s|%s|%s|%s|%d",
+		to.String(rule.Name),
+		properties.Protocol,
+		properties.Access,
+		properties.Direction,
+		strings.Join(securityRuleValues(properties.SourceAddressPrefix, properties.SourceAddressPrefixes), ","),
+		strings.Join(securityRuleValues(properties.SourcePortRange, properties.SourcePortRanges), ","),
+		strings.Join(securityRuleValues(properties.DestinationAddressPrefix, properties.DestinationAddressPrefixes), ","),
+		strings.Join(securityRuleValues(properties.DestinationPortRange, properties.DestinationPortRanges), ","),
+		to.Int32(properties.Priority),
+	))
+}
+
+// securityRuleValues returns the sorted union of the singular and plural form of a network security rule property
+func securityRuleValues(value *string, values *[]string) []string {
+	union := make([]string, 0)
+	if to.String(value) != "" {
+		union = append(union, *value)
+	}
+	if values != nil {
+		union = append(union, *values...)
+	}
+	sort.Strings(union)
+	return union
+}
+
+// ingressSecurityRules converts the ingress rules of the security policy into inbound allow rules, one per CIDR
+// and protocol, followed by a rule which admits the Azure load balancer health probes and a rule which denies all
+// other inbound traffic; the default network security group rules would otherwise admit inbound traffic from
+// the virtual network and the Azure load balancer
+func ingressSecurityRules(policy *SecurityPolicy) ([]network.SecurityRule, error) {
+	rules := make([]network.SecurityRule, 0)
+
+	priority := ingressSecurityRulePriorityStart
+	for _, rule := range policy.Ingress {
+		source, err := securityRuleAddressPrefix(rule)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ingress rule; %s", err.Error())
+		}
+		portRanges := securityRulePortRanges(rule)
+
+		if priority >= securityRulePriorityMax-1 {
+			return nil, fmt.Errorf("too many ingress rules; at most %d are supported", securityRulePriorityMax-ingressSecurityRulePriorityStart-1)
+		}
+
+		rules = append(rules, network.SecurityRule{
+			Name: to.StringPtr(fmt.Sprintf("allow-ingress-%s-%d", rule.Protocol, priority)),
+			SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
+				Description:              to.StringPtr(fmt.Sprintf("allow %s ingress from %s", rule.Protocol, rule.addressPrefix())),
+				Protocol:                 securityRuleProtocol(rule.Protocol),
+				SourceAddressPrefix:      to.StringPtr(source),
+				SourcePortRange:          to.StringPtr("*"),
+				DestinationAddressPrefix: to.StringPtr("*"),
+				DestinationPortRanges:    &portRanges,
+				Access:                   network.SecurityRuleAccessAllow,
+				Direction:                network.SecurityRuleDirectionInbound,
+				Priority:                 to.Int32Ptr(priority),
+			},
+		})
+		priority++
+	}
+
+	rules = append(rules, network.SecurityRule{
+		Name: to.StringPtr(ingressLoadBalancerRuleName),
+		SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
+			Description:              to.StringPtr("allow Azure load balancer health probes"),
+			Protocol:                 network.SecurityRuleProtocolAsterisk,
+			SourceAddressPrefix:      to.StringPtr("AzureLoadBalancer"),
+			SourcePortRange:          to.StringPtr("*"),
+			DestinationAddressPrefix: to.StringPtr("*"),
+			DestinationPortRange:     to.StringPtr("*"),
+			Access:                   network.SecurityRuleAccessAllow,
+			Direction:                network.SecurityRuleDirectionInbound,
+			Priority:                 to.Int32Ptr(securityRulePriorityMax - 1),
+		},
+	})
+
+	rules = append(rules, network.SecurityRule{
+		Name: to.StringPtr(ingressDenyAllRuleName),
+		SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
+			Description:              to.StringPtr("deny all ingress which is not explicitly allowed"),
+			Protocol:                 network.SecurityRuleProtocolAsterisk,
+			SourceAddressPrefix:      to.StringPtr("*"),
+			SourcePortRange:          to.StringPtr("*"),
+			DestinationAddressPrefix: to.StringPtr("*"),
+			DestinationPortRange:     to.StringPtr("*"),
+			Access:                   network.SecurityRuleAccessDeny,
+			Direction:                network.SecurityRuleDirectionInbound,
+			Priority:                 to.Int32Ptr(securityRulePriorityMax),
+		},
+	})
+
+	return rules, nil
+}
+
+// egressSecurityRules converts the egress rules of the security policy into outbound allow rules, one per CIDR or
+// service tag and protocol, followed by a rule which denies all other outbound traffic; no rules are returned when
+// egress is unrestricted
+func egressSecurityRules(policy *SecurityPolicy) ([]network.SecurityRule, error) {
+	rules := make([]network.SecurityRule, 0)
+	if policy.EgressUnrestricted {
+		return rules, nil
+	}
+
+	priority := egressSecurityRulePriorityStart
+	for _, rule := range policy.Egress {
+		destination, err := securityRuleAddressPrefix(rule)
+		if err != nil {
+			return nil, fmt.Errorf("invalid egress rule; %s", err.Error())
+		}
+		portRanges := securityRulePortRanges(rule)
+
+		if priority >= securityRulePriorityMax {
+			return nil, fmt.Errorf("too many egress rules; at most %d are supported", securityRulePriorityMax-egressSecurityRulePriorityStart)
+		}
+
+		rules = append(rules, network.SecurityRule{
+			Name: to.StringPtr(fmt.Sprintf("allow-egress-%s-%d", rule.Protocol, priority)),
+			SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
+				Description:              to.StringPtr(fmt.Sprintf("allow %s egress to %s", rule.Protocol, rule.addressPrefix())),
+				Protocol:                 securityRuleProtocol(rule.Protocol),
+				SourceAddressPrefix:      to.StringPtr("*"),
+				SourcePortRange:          to.StringPtr("*"),
+				DestinationAddressPrefix: to.StringPtr(destination),
+				DestinationPortRanges:    &portRanges,
+				Access:                   network.SecurityRuleAccessAllow,
+				Direction:                network.SecurityRuleDirectionOutbound,
+				Priority:                 to.Int32Ptr(priority),
+			},
+		})
+		priority++
+	}
+
+	rules = append(rules, network.SecurityRule{
+		Name: to.StringPtr(egressDenyAllRuleName),
+		SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
+			Description:              to.StringPtr("deny all egress which is not explicitly allowed"),
+			Protocol:                 network.SecurityRuleProtocolAsterisk,
+			SourceAddressPrefix:      to.StringPtr("*"),
+			SourcePortRange:          to.StringPtr("*"),
+			DestinationAddressPrefix: to.StringPtr("*"),
+			DestinationPortRange:     to.StringPtr("*"),
+			Access:                   network.SecurityRuleAccessDeny,
+			Direction:                network.SecurityRuleDirectionOutbound,
+			Priority:                 to.Int32Ptr(securityRulePriorityMax),
+		},
+	})
+
+	return rules, nil
+}
+
+// securityRuleAddressPrefix returns the normalized CIDR or service tag of the rule as a network security rule address prefix
+func securityRuleAddressPrefix(rule SecurityRule) (string, error) {
+	if rule.ServiceTag != "" {
+		return rule.ServiceTag, nil
+	}
+	if isUnrestrictedCIDR(rule.CIDR) {
+		return "*", nil
+	}
+	_, ipNet, err := net.ParseCIDR(rule.CIDR)
+	if err != nil {
+		return "", fmt.Errorf("invalid CIDR: %s", rule.CIDR)
+	}
+	return ipNet.String(), nil
+}
+
+// securityRulePortRanges returns the port ranges of the rule as network security rule port ranges
+func securityRulePortRanges(rule SecurityRule) []string {
+	portRanges := make([]string, 0, len(rule.Ports))
+	for _, portRange := range rule.Ports {
+		portRanges = append(portRanges, portRange.String())
+	}
+	return portRanges
+}
+
+// securityRuleProtocol maps the security policy protocol to the network security rule protocol
+func securityRuleProtocol(protocol string) network.SecurityRuleProtocol {
+	switch protocol {
+	case SecurityProtocolTCP:
+		return network.SecurityRuleProtocolTCP
+	case SecurityProtocolUDP:
+		return network.SecurityRuleProtocolUDP
+	}
+	return network.SecurityRuleProtocolAsterisk
+}
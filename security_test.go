@@ -0,0 +1,232 @@
+package azurewrapper
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/containerinstance/mgmt/2018-10-01/containerinstance"
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-12-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+func TestIngressSecurityRules(t *testing.T) {
+	security := map[string]interface{}{
+		"ingress": map[string]interface{}{
+			"10.1.0.0/16": map[string]interface{}{
+				"tcp": []interface{}{float64(4221), float64(4222)},
+				"udp": []interface{}{float64(4223)},
+			},
+			"0.0.0.0/0": map[string]interface{}{
+				"tcp": []interface{}{float64(443)},
+			},
+		},
+	}
+
+	policy, err := ParseSecurityPolicy(security)
+	if err != nil {
+		t.Fatalf("expected security policy; %s", err.Error())
+	}
+
+	rules, err := ingressSecurityRules(policy)
+	if err != nil {
+		t.Fatalf("expected ingress rules; %s", err.Error())
+	}
+	if len(rules) != 5 {
+		t.Fatalf("expected 3 allow rules, a load balancer rule and a deny-all rule; got %d", len(rules))
+	}
+
+	if to.String(rules[0].SourceAddressPrefix) != "*" || (*rules[0].DestinationPortRanges)[0] != "443" {
+		t.Errorf("expected unrestricted rule for 0.0.0.0/0; got %+v", rules[0].SecurityRulePropertiesFormat)
+	}
+	if to.String(rules[1].SourceAddressPrefix) != "10.1.0.0/16" || rules[1].Protocol != network.SecurityRuleProtocolTCP || len(*rules[1].DestinationPortRanges) != 2 {
+		t.Errorf("expected tcp rule restricted to 10.1.0.0/16; got %+v", rules[1].SecurityRulePropertiesFormat)
+	}
+	if rules[2].Protocol != network.SecurityRuleProtocolUDP || rules[2].Direction != network.SecurityRuleDirectionInbound {
+		t.Errorf("expected inbound udp rule; got %+v", rules[2].SecurityRulePropertiesFormat)
+	}
+	if *rules[0].Priority == *rules[1].Priority || *rules[1].Priority == *rules[2].Priority {
+		t.Errorf("expected unique rule priorities")
+	}
+
+	if to.String(rules[3].SourceAddressPrefix) != "AzureLoadBalancer" || *rules[3].Priority <= *rules[2].Priority {
+		t.Errorf("expected Azure load balancer health probes to be allowed; got %+v", rules[3].SecurityRulePropertiesFormat)
+	}
+	denyAll := rules[4]
+	if to.String(denyAll.Name) != ingressDenyAllRuleName || denyAll.Access != network.SecurityRuleAccessDeny || denyAll.Direction != network.SecurityRuleDirectionInbound || *denyAll.Priority != securityRulePriorityMax {
+		t.Errorf("expected lowest priority deny-all ingress rule; got %+v", denyAll.SecurityRulePropertiesFormat)
+	}
+}
+
+func TestSubnetSecurityGroupConflict(t *testing.T) {
+	nsgID := "/subscriptions/sub/resourceGroups/skynet/providers/Microsoft.Network/networkSecurityGroups/vnet-containers-nsg"
+	subnet := network.Subnet{
+		Name: to.StringPtr("containers"),
+		SubnetPropertiesFormat: &network.SubnetPropertiesFormat{
+			NetworkSecurityGroup: &network.SecurityGroup{ID: to.StringPtr(nsgID)},
+		},
+	}
+
+	if err := subnetSecurityGroupConflict(subnet, strings.ToUpper(nsgID), false); err != nil {
+		t.Errorf("expected the same network security group not to conflict; %s", err.Error())
+	}
+	if _, ok := subnetSecurityGroupConflict(subnet, nsgID+"-other", false).(*SubnetSecurityGroupConflictError); !ok {
+		t.Errorf("expected a different network security group to conflict")
+	}
+	if err := subnetSecurityGroupConflict(subnet, nsgID+"-other", true); err != nil {
+		t.Errorf("expected a different network security group to be replaced when requested")
+	}
+}
+
+func TestIngressSecurityRulesInvalidCIDR(t *testing.T) {
+	_, err := ingressSecurityRules(&SecurityPolicy{
+		Ingress: []SecurityRule{
+			{CIDR: "10.1.0.0", Protocol: SecurityProtocolTCP, Ports: []PortRange{{From: 22, To: 22}}},
+		},
+	})
+	if err == nil {
+		t.Errorf("expected invalid CIDR to be rejected")
+	}
+}
+
+func TestRestrictedIngressCIDRsRejectedByContainerGroup(t *testing.T) {
+	cp := reconcileTestParams()
+	cp.Security = map[string]interface{}{
+		"ingress": map[string]interface{}{
+			"0.0.0.0/0":      map[string]interface{}{"tcp": []interface{}{float64(4222)}},
+			"192.168.0.0/24": map[string]interface{}{"tcp": []interface{}{float64(22)}},
+		},
+	}
+
+	_, err := containerGroupFromParams(cp, tc, nil)
+	restrictionErr, ok := err.(*IngressSourceRestrictionError)
+	if !ok {
+		t.Fatalf("expected ingress source restriction error; got %v", err)
+	}
+	if len(restrictionErr.CIDRs) != 1 || restrictionErr.CIDRs[0] != "192.168.0.0/24" {
+		t.Errorf("expected restricted CIDR to be reported; got %v", restrictionErr.CIDRs)
+	}
+}
+
+func TestEgressSecurityRules(t *testing.T) {
+	policy, err := ParseSecurityPolicy(map[string]interface{}{
+		"egress": map[string]interface{}{
+			"10.0.0.0/8": map[string]interface{}{"tcp": []interface{}{float64(4222)}},
+			"Storage":    map[string]interface{}{"tcp": []interface{}{float64(443)}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("expected security policy; %s", err.Error())
+	}
+
+	rules, err := egressSecurityRules(policy)
+	if err != nil {
+		t.Fatalf("expected egress rules; %s", err.Error())
+	}
+	if len(rules) != 3 {
+		t.Fatalf("expected 2 allow rules and a deny-all rule; got %d", len(rules))
+	}
+
+	if to.String(rules[0].DestinationAddressPrefix) != "10.0.0.0/8" || rules[0].Access != network.SecurityRuleAccessAllow {
+		t.Errorf("expected egress to be allowed to 10.0.0.0/8; got %+v", rules[0].SecurityRulePropertiesFormat)
+	}
+	if to.String(rules[1].DestinationAddressPrefix) != "Storage" || rules[1].Direction != network.SecurityRuleDirectionOutbound {
+		t.Errorf("expected egress to be allowed to the Storage service tag; got %+v", rules[1].SecurityRulePropertiesFormat)
+	}
+
+	denyAll := rules[2]
+	if to.String(denyAll.Name) != egressDenyAllRuleName || denyAll.Access != network.SecurityRuleAccessDeny || *denyAll.Priority <= *rules[1].Priority {
+		t.Errorf("expected lowest priority deny-all egress rule; got %+v", denyAll.SecurityRulePropertiesFormat)
+	}
+}
+
+func TestEgressSecurityRulesUnrestricted(t *testing.T) {
+	rules, err := egressSecurityRules(&SecurityPolicy{EgressUnrestricted: true})
+	if err != nil || len(rules) != 0 {
+		t.Errorf("expected no egress rules when egress is unrestricted")
+	}
+}
+
+func TestRestrictedEgressRejectedByContainerGroup(t *testing.T) {
+	cp := reconcileTestParams()
+	cp.Security["egress"] = map[string]interface{}{
+		"10.0.0.0/8": map[string]interface{}{"tcp": []interface{}{float64(443)}},
+	}
+
+	_, err := containerGroupFromParams(cp, tc, nil)
+	if _, ok := err.(*EgressRestrictionError); !ok {
+		t.Errorf("expected egress restriction error; got %v", err)
+	}
+}
+
+func TestRestrictedSecurityPolicyEnforcedOnSubnet(t *testing.T) {
+	cp := reconcileTestParams()
+	cp.Security = map[string]interface{}{
+		"ingress": map[string]interface{}{
+			"192.168.0.0/24": map[string]interface{}{"tcp": []interface{}{float64(4222)}},
+		},
+		"egress": map[string]interface{}{
+			"10.0.0.0/8": map[string]interface{}{"tcp": []interface{}{float64(443)}},
+		},
+	}
+
+	containerGroup, err := containerGroupFromParams(cp, tc, &ContainerOptions{
+		SubnetID: "/subscriptions/sub/resourceGroups/network/providers/Microsoft.Network/virtualNetworks/vnet/subnets/containers",
+	})
+	if err != nil {
+		t.Fatalf("expected container group deployed into a subnet to accept restricted ingress and egress; %s", err.Error())
+	}
+	if containerGroup.IPAddress.Type != containerinstance.Private || containerGroup.IPAddress.DNSNameLabel != nil {
+		t.Errorf("expected private IP address without DNS name label; got %+v", containerGroup.IPAddress)
+	}
+	if containerGroup.NetworkProfile == nil || resourceIDSegment(to.String(containerGroup.NetworkProfile.ID), "networkProfiles") != "vnet-containers-profile" {
+		t.Errorf("expected network profile of the subnet; got %+v", containerGroup.NetworkProfile)
+	}
+	if resourceIDSegment(to.String(containerGroup.NetworkProfile.ID), "resourceGroups") != "network" {
+		t.Errorf("expected network profile in the resource group of the subnet")
+	}
+}
+
+func TestSubnetIDsDoNotDeployIntoSubnet(t *testing.T) {
+	cp := reconcileTestParams()
+	cp.SubnetIds = []string{"subnet1", "subnet2"}
+
+	containerGroup, err := containerGroupFromParams(cp, tc, nil)
+	if err != nil {
+		t.Fatalf("expected subnet IDs of the container params to be ignored; %s", err.Error())
+	}
+	if containerGroup.IPAddress.Type != containerinstance.Public || containerGroup.NetworkProfile != nil {
+		t.Errorf("expected public IP address without network profile; got %+v", containerGroup.IPAddress)
+	}
+}
+
+func TestSecurityRulesEqual(t *testing.T) {
+	policy := &SecurityPolicy{
+		Ingress: []SecurityRule{{CIDR: "192.168.0.0/24", Protocol: SecurityProtocolTCP, Ports: []PortRange{{From: 4222, To: 4222}}}},
+	}
+	rules, err := securityPolicyRules(policy)
+	if err != nil {
+		t.Fatalf("expected security rules; %s", err.Error())
+	}
+
+	existing := make([]network.SecurityRule, len(rules))
+	copy(existing, rules)
+	existing[0].SecurityRulePropertiesFormat = &network.SecurityRulePropertiesFormat{}
+	*existing[0].SecurityRulePropertiesFormat = *rules[0].SecurityRulePropertiesFormat
+	existing[0].Description = to.StringPtr("updated out of band")
+	existing[0].DestinationPortRange = to.StringPtr("4222")
+	existing[0].DestinationPortRanges = &[]string{}
+	nsg := &network.SecurityGroup{SecurityGroupPropertiesFormat: &network.SecurityGroupPropertiesFormat{SecurityRules: &existing}}
+	if !securityRulesEqual(nsg, rules) {
+		t.Errorf("expected rules differing only in form to be equal")
+	}
+
+	changed, _ := securityPolicyRules(&SecurityPolicy{
+		Ingress: []SecurityRule{{CIDR: "192.168.0.0/24", Protocol: SecurityProtocolTCP, Ports: []PortRange{{From: 443, To: 443}}}},
+	})
+	if securityRulesEqual(nsg, changed) {
+		t.Errorf("expected rules with other ports to differ")
+	}
+	if securityRulesEqual(nil, rules) {
+		t.Errorf("expected missing network security group to differ")
+	}
+}
@@ -0,0 +1,233 @@
+package azurewrapper
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/containerinstance/mgmt/2018-10-01/containerinstance"
+	"github.com/Azure/go-autorest/autorest/date"
+	"github.com/Azure/go-autorest/autorest/to"
+
+	provide "github.com/provideplatform/provide-go/api/c2"
+)
+
+// Provider-neutral container group statuses
+const (
+	ContainerStatusPending    = "pending"
+	ContainerStatusRunning    = "running"
+	ContainerStatusStopped    = "stopped"
+	ContainerStatusTerminated = "terminated"
+	ContainerStatusFailed     = "failed"
+	ContainerStatusUnknown    = "unknown"
+)
+
+// ContainerEvent is an event reported in the instance view of a container group or container
+type ContainerEvent struct {
+	Name           string
+	Type           string
+	Message        string
+	Count          int32
+	FirstTimestamp *time.Time
+	LastTimestamp  *time.Time
+}
+
+// ContainerState is the current or previous state of a container
+type ContainerState struct {
+	State        string
+	DetailStatus string
+	ExitCode     *int32
+	StartTime    *time.Time
+	FinishTime   *time.Time
+}
+
+// ContainerStatus is the status of a single container of a container group
+type ContainerStatus struct {
+	Name          string
+	Image         string
+	RestartCount  int32
+	CurrentState  *ContainerState
+	PreviousState *ContainerState
+	Events        []ContainerEvent
+}
+
+// ContainerGroupStatus is the status of a container group; Status is one of the provider-neutral container
+// statuses, and Node maps the addresses and status of the container group into a provider-neutral node
+type ContainerGroupStatus struct {
+	ID                string
+	Name              string
+	Region            string
+	FQDN              string
+	Status            string
+	ProvisioningState string
+	State             string
+	Containers        []ContainerStatus
+	Events            []ContainerEvent
+	ProbeFailures     []*ContainerProbeFailure
+	Node              *provide.Node
+}
+
+// GetContainerGroup returns the container group with the given name, including its instance view
+func GetContainerGroup(ctx context.Context, tc *provide.TargetCredentials, resourceGroupName, containerGroupName string) (containerGroup containerinstance.ContainerGroup, err error) {
+	cgClient, err := NewContainerGroupsClient(tc)
+	if err != nil {
+		return containerGroup, fmt.Errorf("Unable to get container group client: %s; ", err.Error())
+	}
+
+	containerGroup, err = cgClient.Get(ctx, resourceGroupName, containerGroupName)
+	if err != nil {
+		return containerGroup, fmt.Errorf("Unable to get container group: %s; ", err.Error())
+	}
+
+	return containerGroup, nil
+}
+
+// DescribeContainer returns the status of the container group with the given name, including its provisioning
+// state, instance view state, containers, events and probe failures
+func DescribeContainer(ctx context.Context, tc *provide.TargetCredentials, resourceGroupName, containerGroupName string) (*ContainerGroupStatus, error) {
+	containerGroup, err := GetContainerGroup(ctx, tc, resourceGroupName, containerGroupName)
+	if err != nil {
+		return nil, err
+	}
+
+	return containerGroupStatus(containerGroup), nil
+}
+
+// containerGroupStatus maps the given container group into its status
+func containerGroupStatus(containerGroup containerinstance.ContainerGroup) *ContainerGroupStatus {
+	intf := containerGroupNetworkInterface(containerGroup)
+	provisioningState, state := containerGroupStates(containerGroup)
+	neutralStatus := neutralContainerStatus(provisioningState, state)
+
+	status := &ContainerGroupStatus{
+		ID:                to.String(containerGroup.ID),
+		Name:              to.String(containerGroup.Name),
+		Region:            to.String(containerGroup.Location),
+		FQDN:              to.String(intf.Host),
+		Status:            neutralStatus,
+		ProvisioningState: provisioningState,
+		State:             state,
+		Containers:        make([]ContainerStatus, 0),
+		Events:            make([]ContainerEvent, 0),
+		ProbeFailures:     containerProbeFailures(containerGroup),
+		Node: &provide.Node{
+			Host:        intf.Host,
+			IPv4:        intf.IPv4,
+			IPv6:        intf.IPv6,
+			PrivateIPv4: intf.PrivateIPv4,
+			PrivateIPv6: intf.PrivateIPv6,
+			Status:      to.StringPtr(neutralStatus),
+		},
+	}
+
+	if containerGroup.ContainerGroupProperties == nil {
+		return status
+	}
+
+	if containerGroup.InstanceView != nil {
+		status.Events = containerEvents(containerGroup.InstanceView.Events)
+	}
+
+	if containerGroup.Containers != nil {
+		for _, container := range *containerGroup.Containers {
+			containerStatus := ContainerStatus{
+				Name:   to.String(container.Name),
+				Events: make([]ContainerEvent, 0),
+			}
+			if container.ContainerProperties != nil {
+				containerStatus.Image = to.String(container.Image)
+				if container.InstanceView != nil {
+					containerStatus.RestartCount = to.Int32(container.InstanceView.RestartCount)
+					containerStatus.CurrentState = containerState(container.InstanceView.CurrentState)
+					containerStatus.PreviousState = containerState(container.InstanceView.PreviousState)
+					containerStatus.Events = containerEvents(container.InstanceView.Events)
+				}
+			}
+			status.Containers = append(status.Containers, containerStatus)
+		}
+	}
+
+	return status
+}
+
+// containerGroupStates returns the provisioning state and the instance view state of the given container group
+func containerGroupStates(containerGroup containerinstance.ContainerGroup) (string, string) {
+	if containerGroup.ContainerGroupProperties == nil {
+		return "", ""
+	}
+
+	state := ""
+	if containerGroup.InstanceView != nil {
+		state = to.String(containerGroup.InstanceView.State)
+	}
+	return to.String(containerGroup.ProvisioningState), state
+}
+
+// neutralContainerStatus maps the Azure provisioning and instance view states into a provider-neutral status
+func neutralContainerStatus(provisioningState, state string) string {
+	switch strings.ToLower(provisioningState) {
+	case "pending", "creating", "updating", "repairing":
+		return ContainerStatusPending
+	case "failed", "unhealthy":
+		return ContainerStatusFailed
+	case "deleting":
+		return ContainerStatusStopped
+	}
+
+	switch strings.ToLower(state) {
+	case "running":
+		return ContainerStatusRunning
+	case "pending", "waiting":
+		return ContainerStatusPending
+	case "stopped":
+		return ContainerStatusStopped
+	case "succeeded", "terminated":
+		return ContainerStatusTerminated
+	case "failed":
+		return ContainerStatusFailed
+	}
+
+	if strings.EqualFold(provisioningState, "succeeded") {
+		return ContainerStatusPending
+	}
+	return ContainerStatusUnknown
+}
+
+func containerState(state *containerinstance.ContainerState) *ContainerState {
+	if state == nil {
+		return nil
+	}
+	return &ContainerState{
+		State:        to.String(state.State),
+		DetailStatus: to.String(state.DetailStatus),
+		ExitCode:     state.ExitCode,
+		StartTime:    dateTime(state.StartTime),
+		FinishTime:   dateTime(state.FinishTime),
+	}
+}
+
+func containerEvents(events *[]containerinstance.Event) []ContainerEvent {
+	mapped := make([]ContainerEvent, 0)
+	if events == nil {
+		return mapped
+	}
+	for _, event := range *events {
+		mapped = append(mapped, ContainerEvent{
+			Name:           to.String(event.Name),
+			Type:           to.String(event.Type),
+			Message:        to.String(event.Message),
+			Count:          to.Int32(event.Count),
+			FirstTimestamp: dateTime(event.FirstTimestamp),
+			LastTimestamp:  dateTime(event.LastTimestamp),
+		})
+	}
+	return mapped
+}
+
+func dateTime(t *date.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	return &t.Time
+}
@@ -0,0 +1,92 @@
+package azurewrapper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/containerinstance/mgmt/2018-10-01/containerinstance"
+	"github.com/Azure/go-autorest/autorest/date"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+func TestContainerGroupStatus(t *testing.T) {
+	started := date.Time{Time: time.Now().Add(-time.Minute)}
+	containerGroup := containerinstance.ContainerGroup{
+		ID:       to.StringPtr("/subscriptions/sub/resourceGroups/skynet/providers/Microsoft.ContainerInstance/containerGroups/nats"),
+		Name:     to.StringPtr("nats"),
+		Location: to.StringPtr("eastus"),
+		ContainerGroupProperties: &containerinstance.ContainerGroupProperties{
+			ProvisioningState: to.StringPtr("Succeeded"),
+			IPAddress: &containerinstance.IPAddress{
+				IP:   to.StringPtr("20.1.2.3"),
+				Fqdn: to.StringPtr("nats-1234.eastus.azurecontainer.io"),
+			},
+			InstanceView: &containerinstance.ContainerGroupPropertiesInstanceView{
+				State: to.StringPtr("Running"),
+			},
+			Containers: &[]containerinstance.Container{
+				{
+					Name: to.StringPtr("nats"),
+					ContainerProperties: &containerinstance.ContainerProperties{
+						Image: to.StringPtr("provide/nats-server:latest"),
+						InstanceView: &containerinstance.ContainerPropertiesInstanceView{
+							RestartCount: to.Int32Ptr(2),
+							CurrentState: &containerinstance.ContainerState{
+								State:     to.StringPtr("Running"),
+								StartTime: &started,
+							},
+							PreviousState: &containerinstance.ContainerState{
+								State:    to.StringPtr("Terminated"),
+								ExitCode: to.Int32Ptr(137),
+							},
+							Events: &[]containerinstance.Event{
+								{Name: to.StringPtr("Unhealthy"), Message: to.StringPtr("Liveness probe failed: timeout"), Count: to.Int32Ptr(3)},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	status := containerGroupStatus(containerGroup)
+	if status.Status != ContainerStatusRunning || to.String(status.Node.Status) != ContainerStatusRunning {
+		t.Errorf("expected running status; got %s", status.Status)
+	}
+	if status.FQDN != "nats-1234.eastus.azurecontainer.io" || to.String(status.Node.IPv4) != "20.1.2.3" {
+		t.Errorf("expected network interface to be mapped; got %s and %s", status.FQDN, to.String(status.Node.IPv4))
+	}
+	if status.ProvisioningState != "Succeeded" || status.State != "Running" {
+		t.Errorf("expected provisioning and instance view states to be reported")
+	}
+	if len(status.Containers) != 1 || status.Containers[0].RestartCount != 2 {
+		t.Fatalf("expected container status with restart count 2")
+	}
+	previousState := status.Containers[0].PreviousState
+	currentState := status.Containers[0].CurrentState
+	if previousState == nil || previousState.ExitCode == nil || *previousState.ExitCode != 137 || currentState == nil || currentState.StartTime == nil {
+		t.Errorf("expected current and previous container states to be mapped")
+	}
+	if len(status.Containers[0].Events) != 1 || status.Containers[0].Events[0].Count != 3 {
+		t.Errorf("expected container events to be mapped")
+	}
+	if len(status.ProbeFailures) != 1 {
+		t.Errorf("expected probe failure to be reported")
+	}
+}
+
+func TestNeutralContainerStatus(t *testing.T) {
+	cases := map[[2]string]string{
+		{"Creating", ""}:           ContainerStatusPending,
+		{"Failed", "Running"}:      ContainerStatusFailed,
+		{"Succeeded", "Stopped"}:   ContainerStatusStopped,
+		{"Succeeded", "Succeeded"}: ContainerStatusTerminated,
+		{"Succeeded", ""}:          ContainerStatusPending,
+		{"", ""}:                   ContainerStatusUnknown,
+	}
+	for states, expected := range cases {
+		if status := neutralContainerStatus(states[0], states[1]); status != expected {
+			t.Errorf("expected %s for %v; got %s", expected, states, status)
+		}
+	}
+}
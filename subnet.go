@@ -0,0 +1,158 @@
+package azurewrapper
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-12-01/network"
+
+	provide "github.com/provideplatform/provide-go/api/c2"
+)
+
+// UpsertSubnet upserts a single subnet of the given virtual network without modifying its other subnets; when no
+// address prefix is given, the existing prefix of the subnet is reused or a free range of the configured subnet
+// prefix length is allocated within the virtual network address space. The properties of an existing
+// subnet which are not set in the spec, such as its network security group, are retained
+func UpsertSubnet(ctx context.Context, tc *provide.TargetCredentials, groupName, virtualNetworkName string, spec SubnetSpec) (*network.Subnet, error) {
+	cidrAllocationMutex.Lock()
+	defer cidrAllocationMutex.Unlock()
+
+	vnet, err := getVirtualNetwork(ctx, tc, groupName, virtualNetworkName)
+	if err != nil {
+		return nil, err
+	}
+	if vnet == nil {
+		return nil, fmt.Errorf("cannot create subnet: virtual network %s not found", virtualNetworkName)
+	}
+
+	vnetSpec, err := subnetVirtualNetworkSpec(vnet, spec)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create subnet: %v", err)
+	}
+	spec = vnetSpec.Subnets[len(vnetSpec.Subnets)-1]
+
+	subnetClient, err := NewSubnetsClient(tc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create subnet client; %s", err.Error())
+	}
+
+	future, err := subnetClient.CreateOrUpdate(ctx, groupName, virtualNetworkName, spec.Name, subnetFromSpec(spec, virtualNetworkSubnet(vnet, spec.Name)))
+	if err != nil {
+		return nil, fmt.Errorf("cannot create subnet: %v", err)
+	}
+
+	err = future.WaitForCompletionRef(ctx, subnetClient.Client)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get the subnet create or update future response: %v", err)
+	}
+
+	subnet, err := future.Result(subnetClient)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create new subnet; %s", err.Error())
+	}
+
+	return &subnet, nil
+}
+
+// GetSubnet returns the subnet with the given name
+func GetSubnet(ctx context.Context, tc *provide.TargetCredentials, groupName, virtualNetworkName, name string) (*network.Subnet, error) {
+	subnetClient, err := NewSubnetsClient(tc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create subnet client; %s", err.Error())
+	}
+
+	subnet, err := subnetClient.Get(ctx, groupName, virtualNetworkName, name, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get subnet %s; %s", name, err.Error())
+	}
+
+	return &subnet, nil
+}
+
+// ListSubnets returns the subnets of the given virtual network
+func ListSubnets(ctx context.Context, tc *provide.TargetCredentials, groupName, virtualNetworkName string) ([]network.Subnet, error) {
+	subnetClient, err := NewSubnetsClient(tc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create subnet client; %s", err.Error())
+	}
+
+	it, err := subnetClient.ListComplete(ctx, groupName, virtualNetworkName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list subnets of virtual network %s; %s", virtualNetworkName, err.Error())
+	}
+
+	subnets := make([]network.Subnet, 0)
+	for it.NotDone() {
+		subnets = append(subnets, it.Value())
+
+		err = it.NextWithContext(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list subnets of virtual network %s; %s", virtualNetworkName, err.Error())
+		}
+	}
+
+	return subnets, nil
+}
+
+// DeleteSubnet deletes the subnet with the given name; no error is returned if the subnet does not exist
+func DeleteSubnet(ctx context.Context, tc *provide.TargetCredentials, groupName, virtualNetworkName, name string) error {
+	subnetClient, err := NewSubnetsClient(tc)
+	if err != nil {
+		return fmt.Errorf("failed to create subnet client; %s", err.Error())
+	}
+
+	future, err := subnetClient.Delete(ctx, groupName, virtualNetworkName, name)
+	if err != nil {
+		if isNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("cannot delete subnet: %v", err)
+	}
+
+	err = future.WaitForCompletionRef(ctx, subnetClient.Client)
+	if err != nil {
+		return fmt.Errorf("cannot get the subnet delete future response: %v", err)
+	}
+
+	return nil
+}
+
+// subnetVirtualNetworkSpec returns the spec of the given virtual network with the given subnet in place of any
+// existing subnet of the same name, as the last subnet; its address prefix is allocated if not given, and the
+// spec is validated so the subnet is known to be within the address space and not to overlap other subnets
+func subnetVirtualNetworkSpec(vnet *network.VirtualNetwork, subnet SubnetSpec) (*VirtualNetworkSpec, error) {
+	spec := &VirtualNetworkSpec{
+		AddressPrefixes: make([]string, 0),
+		Subnets:         make([]SubnetSpec, 0),
+	}
+	if vnet.VirtualNetworkPropertiesFormat != nil && vnet.AddressSpace != nil && vnet.AddressSpace.AddressPrefixes != nil {
+		spec.AddressPrefixes = append(spec.AddressPrefixes, *vnet.AddressSpace.AddressPrefixes...)
+	}
+
+	existingSubnets := virtualNetworkSubnetPrefixes(vnet)
+	for name, prefix := range existingSubnets {
+		if !strings.EqualFold(name, subnet.Name) {
+			spec.Subnets = append(spec.Subnets, SubnetSpec{Name: name, AddressPrefix: prefix})
+		}
+	}
+	spec.Subnets = append(spec.Subnets, subnet)
+
+	if subnet.AddressPrefix == "" {
+		vnetAllocationMutex.Lock()
+		prefixLength := vnetAllocation.SubnetPrefixLength
+		vnetAllocationMutex.Unlock()
+
+		err := allocateSubnetPrefixes(spec, existingSubnets, prefixLength)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := spec.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return spec, nil
+}
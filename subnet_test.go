@@ -0,0 +1,38 @@
+package azurewrapper
+
+import (
+	"testing"
+)
+
+func TestSubnetVirtualNetworkSpec(t *testing.T) {
+	vnet := existingTestVirtualNetwork()
+
+	spec, err := subnetVirtualNetworkSpec(vnet, SubnetSpec{Name: "nodes", Delegations: []string{"Microsoft.ContainerInstance/containerGroups"}})
+	if err != nil {
+		t.Errorf("failed to allocate subnet; %s", err.Error())
+		return
+	}
+	subnet := spec.Subnets[len(spec.Subnets)-1]
+	if subnet.AddressPrefix != "10.4.2.0/24" {
+		t.Errorf("expected new subnet to be allocated 10.4.2.0/24; got %s", subnet.AddressPrefix)
+	}
+	if len(subnet.Delegations) != 1 {
+		t.Errorf("expected subnet delegation to be retained")
+	}
+
+	spec, err = subnetVirtualNetworkSpec(vnet, SubnetSpec{Name: "containers", NetworkSecurityGroupID: "nsg"})
+	if err != nil {
+		t.Errorf("failed to update subnet; %s", err.Error())
+		return
+	}
+	if len(spec.Subnets) != 2 || spec.Subnets[1].AddressPrefix != "10.4.1.0/24" {
+		t.Errorf("expected existing subnet to be updated in place with its address prefix; got %+v", spec.Subnets)
+	}
+
+	if _, err := subnetVirtualNetworkSpec(vnet, SubnetSpec{Name: "nodes", AddressPrefix: "10.4.1.128/25"}); err == nil {
+		t.Errorf("expected overlapping subnet to be rejected")
+	}
+	if _, err := subnetVirtualNetworkSpec(vnet, SubnetSpec{Name: "nodes", AddressPrefix: "10.5.0.0/24"}); err == nil {
+		t.Errorf("expected subnet outside of the address space to be rejected")
+	}
+}
@@ -0,0 +1,127 @@
+package azurewrapper
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+const tagKeyOwner = "owner"
+const tagKeyEnvironment = "environment"
+const tagKeyNetworkID = "network_id"
+const tagKeyCreatedBy = "created-by"
+
+// tagKeyManagedBy marks the resources created by this package; resources which existed before they were upserted
+// are never marked, and dependent resources are only ever deleted on behalf of a container group when they carry it
+const tagKeyManagedBy = "managed_by"
+const managedByTagValue = "go-azure-wrapper"
+
+const maxResourceTags = 50
+const maxTagKeyLength = 512
+const maxTagValueLength = 256
+
+// ResourceTags is a struct representing the default tags applied to every resource created or upserted by this package
+type ResourceTags struct {
+	Owner       string
+	Environment string
+	NetworkID   string
+	CreatedBy   string
+	Extra       map[string]string
+}
+
+var (
+	defaultTags      map[string]string
+	defaultTagsMutex sync.RWMutex
+)
+
+// ConfigureDefaultTags sets the default tags which are merged into the tags given to each create or upsert call;
+// per-call tags take precedence over the defaults
+func ConfigureDefaultTags(tags *ResourceTags) {
+	defaultTagsMutex.Lock()
+	defer defaultTagsMutex.Unlock()
+
+	defaultTags = map[string]string{}
+	if tags == nil {
+		return
+	}
+
+	for k, v := range tags.Extra {
+		defaultTags[k] = v
+	}
+	if tags.Owner != "" {
+		defaultTags[tagKeyOwner] = tags.Owner
+	}
+	if tags.Environment != "" {
+		defaultTags[tagKeyEnvironment] = tags.Environment
+	}
+	if tags.NetworkID != "" {
+		defaultTags[tagKeyNetworkID] = tags.NetworkID
+	}
+	if tags.CreatedBy != "" {
+		defaultTags[tagKeyCreatedBy] = tags.CreatedBy
+	}
+}
+
+// resourceTags merges the given tags into the configured defaults and returns them in the form expected by Azure;
+// the managed tag is reserved, see upsertedResourceTags
+func resourceTags(tags map[string]string) (map[string]*string, error) {
+	defaultTagsMutex.RLock()
+	merged := make(map[string]string, len(defaultTags)+len(tags))
+	for k, v := range defaultTags {
+		merged[k] = v
+	}
+	defaultTagsMutex.RUnlock()
+
+	for k, v := range tags {
+		merged[k] = v
+	}
+	delete(merged, tagKeyManagedBy)
+
+	if len(merged) > maxResourceTags {
+		return nil, fmt.Errorf("too many resource tags: %d; at most %d are supported", len(merged), maxResourceTags)
+	}
+
+	azureTags := make(map[string]*string, len(merged))
+	for k, v := range merged {
+		if k == "" || len(k) > maxTagKeyLength {
+			return nil, fmt.Errorf("invalid resource tag key: %s", k)
+		}
+		if len(v) > maxTagValueLength {
+			return nil, fmt.Errorf("invalid value for resource tag: %s; exceeds %d characters", k, maxTagValueLength)
+		}
+		azureTags[k] = to.StringPtr(v)
+	}
+
+	return azureTags, nil
+}
+
+// upsertedResourceTags returns the tags of an upserted resource: the tags of a resource which exists are retained
+// and overlaid with the given tags, while a resource which does not exist is created by this package and marked
+// as managed by it
+func upsertedResourceTags(tags map[string]*string, existing map[string]*string, exists bool) (map[string]*string, error) {
+	merged := make(map[string]*string, len(existing)+len(tags)+1)
+	if exists {
+		for k, v := range existing {
+			merged[k] = v
+		}
+	} else {
+		merged[tagKeyManagedBy] = to.StringPtr(managedByTagValue)
+	}
+
+	for k, v := range tags {
+		if k != tagKeyManagedBy {
+			merged[k] = v
+		}
+	}
+
+	if len(merged) > maxResourceTags {
+		return nil, fmt.Errorf("too many resource tags: %d including the existing tags; at most %d are supported", len(merged), maxResourceTags)
+	}
+	return merged, nil
+}
+
+// isManagedResource returns true if the given tags mark the resource as managed by this package
+func isManagedResource(tags map[string]*string) bool {
+	return tags != nil && to.String(tags[tagKeyManagedBy]) == managedByTagValue
+}
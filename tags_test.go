@@ -0,0 +1,97 @@
+package azurewrapper
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+func TestResourceTagsMergesDefaults(t *testing.T) {
+	ConfigureDefaultTags(&ResourceTags{
+		Owner:       "ops",
+		Environment: "staging",
+		NetworkID:   "abc",
+		CreatedBy:   "azurewrapper",
+		Extra:       map[string]string{"cost_center": "42"},
+	})
+	defer ConfigureDefaultTags(nil)
+
+	tags, err := resourceTags(map[string]string{"environment": "production", "role": "peer"})
+	if err != nil {
+		t.Fatalf("failed to merge resource tags; %s", err.Error())
+	}
+
+	expected := map[string]string{
+		"owner":       "ops",
+		"environment": "production",
+		"network_id":  "abc",
+		"created-by":  "azurewrapper",
+		"cost_center": "42",
+		"role":        "peer",
+	}
+	if len(tags) != len(expected) {
+		t.Errorf("expected %d tags; got %d", len(expected), len(tags))
+	}
+	for k, v := range expected {
+		if tags[k] == nil || *tags[k] != v {
+			t.Errorf("expected tag %s=%s; got %v", k, v, tags[k])
+		}
+	}
+}
+
+func TestResourceTagsValidation(t *testing.T) {
+	if _, err := resourceTags(map[string]string{"owner": strings.Repeat("x", maxTagValueLength+1)}); err == nil {
+		t.Errorf("expected error for oversized tag value")
+	}
+
+	tags := map[string]string{}
+	for i := 0; i <= maxResourceTags; i++ {
+		tags[strings.Repeat("k", i+1)] = "v"
+	}
+	if _, err := resourceTags(tags); err == nil {
+		t.Errorf("expected error for too many tags")
+	}
+
+	unmanaged, err := resourceTags(map[string]string{tagKeyManagedBy: managedByTagValue})
+	if err != nil || len(unmanaged) != 0 || isManagedResource(unmanaged) {
+		t.Errorf("expected the managed tag to be reserved")
+	}
+	if isManagedResource(nil) || isManagedResource(map[string]*string{tagKeyManagedBy: nil}) {
+		t.Errorf("expected untagged resources not to be managed")
+	}
+}
+
+func TestUpsertedResourceTags(t *testing.T) {
+	tags, _ := resourceTags(map[string]string{"role": "peer"})
+
+	created, err := upsertedResourceTags(tags, nil, false)
+	if err != nil || !isManagedResource(created) || to.String(created["role"]) != "peer" {
+		t.Errorf("expected created resource to be marked as managed; got %v", created)
+	}
+
+	existing := map[string]*string{"owner": to.StringPtr("network-team"), "role": to.StringPtr("hub")}
+	updated, err := upsertedResourceTags(tags, existing, true)
+	if err != nil || isManagedResource(updated) {
+		t.Errorf("expected existing resource not to be marked as managed; got %v", updated)
+	}
+	if to.String(updated["owner"]) != "network-team" || to.String(updated["role"]) != "peer" {
+		t.Errorf("expected existing tags to be retained and overlaid; got %v", updated)
+	}
+	if to.String(existing["role"]) != "hub" {
+		t.Errorf("expected existing tags not to be modified")
+	}
+
+	managed, _ := upsertedResourceTags(tags, created, true)
+	if !isManagedResource(managed) {
+		t.Errorf("expected managed resource to remain managed when updated")
+	}
+
+	many := map[string]*string{}
+	for i := 0; i < maxResourceTags; i++ {
+		many[strings.Repeat("k", i+1)] = to.StringPtr("v")
+	}
+	if _, err := upsertedResourceTags(tags, many, true); err == nil {
+		t.Errorf("expected error when the merged tags exceed the limit")
+	}
+}
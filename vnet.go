@@ -0,0 +1,302 @@
+package azurewrapper
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-12-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+
+	provide "github.com/provideplatform/provide-go/api/c2"
+)
+
+// VirtualNetworkSpec is a struct representing the address space and subnets of a virtual network
+type VirtualNetworkSpec struct {
+	AddressPrefixes []string
+	Subnets         []SubnetSpec
+}
+
+// SubnetSpec is a struct representing a named subnet; delegations are given by service name
+// (i.e., `Microsoft.ContainerInstance/containerGroups`) and service endpoints by service (i.e., `Microsoft.Storage`)
+type SubnetSpec struct {
+	Name          string
+	AddressPrefix string
+
+	Delegations      []string
+	ServiceEndpoints []string
+
+	NetworkSecurityGroupID string
+	RouteTableID           string
+}
+
+// requiresAllocation returns true if the spec is nil, or if the address space or any subnet address prefix is not given
+func (s *VirtualNetworkSpec) requiresAllocation() bool {
+	if s == nil || len(s.AddressPrefixes) == 0 {
+		return true
+	}
+	for _, subnet := range s.Subnets {
+		if subnet.AddressPrefix == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// validate returns an error if the address prefixes are invalid or overlap, or if any subnet is invalid,
+// outside of the address space or overlaps another subnet
+func (s *VirtualNetworkSpec) validate() error {
+	if len(s.AddressPrefixes) == 0 {
+		return fmt.Errorf("at least one address prefix is required")
+	}
+
+	addressSpace := make([]*net.IPNet, 0, len(s.AddressPrefixes))
+	for _, prefix := range s.AddressPrefixes {
+		_, ipNet, err := net.ParseCIDR(prefix)
+		if err != nil {
+			return fmt.Errorf("invalid address prefix: %s", prefix)
+		}
+		for _, other := range addressSpace {
+			if cidrsOverlap(ipNet, other) {
+				return fmt.Errorf("address prefix %s overlaps %s", prefix, other.String())
+			}
+		}
+		addressSpace = append(addressSpace, ipNet)
+	}
+
+	names := map[string]bool{}
+	subnets := make([]*net.IPNet, 0, len(s.Subnets))
+	for _, subnet := range s.Subnets {
+		ipNet, err := subnet.validate()
+		if err != nil {
+			return err
+		}
+		if names[strings.ToLower(subnet.Name)] {
+			return fmt.Errorf("duplicate subnet name: %s", subnet.Name)
+		}
+		names[strings.ToLower(subnet.Name)] = true
+
+		contained := false
+		for _, prefix := range addressSpace {
+			if cidrContains(prefix, ipNet) {
+				contained = true
+				break
+			}
+		}
+		if !contained {
+			return fmt.Errorf("subnet %s address prefix %s is outside of the virtual network address space", subnet.Name, subnet.AddressPrefix)
+		}
+
+		for _, other := range subnets {
+			if cidrsOverlap(ipNet, other) {
+				return fmt.Errorf("subnet %s address prefix %s overlaps %s", subnet.Name, subnet.AddressPrefix, other.String())
+			}
+		}
+		subnets = append(subnets, ipNet)
+	}
+
+	return nil
+}
+
+// validate returns the parsed address prefix of the subnet, or an error if the subnet is invalid
+func (s *SubnetSpec) validate() (*net.IPNet, error) {
+	if s.Name == "" {
+		return nil, fmt.Errorf("subnet name is required")
+	}
+
+	_, ipNet, err := net.ParseCIDR(s.AddressPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address prefix for subnet %s: %s", s.Name, s.AddressPrefix)
+	}
+
+	for _, delegation := range s.Delegations {
+		if !strings.Contains(delegation, "/") {
+			return nil, fmt.Errorf("invalid delegation for subnet %s: %s; expected a service name such as Microsoft.ContainerInstance/containerGroups", s.Name, delegation)
+		}
+	}
+
+	return ipNet, nil
+}
+
+// virtualNetworkFromSpec returns the virtual network for the given spec; when the virtual network exists, its DHCP
+// options, peerings, DDoS and VM protection settings and other properties are retained, since the virtual network
+// is replaced as a whole, and the subnets of the spec which exist retain the properties the spec does not set
+func virtualNetworkFromSpec(region string, tags map[string]*string, spec *VirtualNetworkSpec, existing *network.VirtualNetwork) network.VirtualNetwork {
+	addressPrefixes := make([]string, len(spec.AddressPrefixes))
+	copy(addressPrefixes, spec.AddressPrefixes)
+
+	subnets := make([]network.Subnet, 0, len(spec.Subnets))
+	for _, subnet := range spec.Subnets {
+		subnets = append(subnets, subnetFromSpec(subnet, virtualNetworkSubnet(existing, subnet.Name)))
+	}
+
+	properties := &network.VirtualNetworkPropertiesFormat{}
+	if existing != nil && existing.VirtualNetworkPropertiesFormat != nil {
+		*properties = *existing.VirtualNetworkPropertiesFormat
+	}
+	properties.AddressSpace = &network.AddressSpace{
+		AddressPrefixes: &addressPrefixes,
+	}
+	properties.Subnets = &subnets
+
+	return network.VirtualNetwork{
+		Location:                       to.StringPtr(region),
+		Tags:                           tags,
+		VirtualNetworkPropertiesFormat: properties,
+	}
+}
+
+// subnetFromSpec returns the subnet for the given spec; when the subnet exists, its network security group, route
+// table, delegations, service endpoints and other properties are retained unless they are set in the spec, since
+// the subnet is replaced as a whole
+func subnetFromSpec(spec SubnetSpec, existing *network.Subnet) network.Subnet {
+	properties := &network.SubnetPropertiesFormat{}
+	if existing != nil && existing.SubnetPropertiesFormat != nil {
+		*properties = *existing.SubnetPropertiesFormat
+	}
+	properties.AddressPrefix = to.StringPtr(spec.AddressPrefix)
+	properties.AddressPrefixes = nil
+
+	if len(spec.Delegations) > 0 {
+		delegations := make([]network.Delegation, 0, len(spec.Delegations))
+		for _, serviceName := range spec.Delegations {
+			delegations = append(delegations, network.Delegation{
+				Name: to.StringPtr(strings.Replace(serviceName, "/", ".", -1)),
+				ServiceDelegationPropertiesFormat: &network.ServiceDelegationPropertiesFormat{
+					ServiceName: to.StringPtr(serviceName),
+				},
+			})
+		}
+		properties.Delegations = &delegations
+	}
+
+	if len(spec.ServiceEndpoints) > 0 {
+		serviceEndpoints := make([]network.ServiceEndpointPropertiesFormat, 0, len(spec.ServiceEndpoints))
+		for _, service := range spec.ServiceEndpoints {
+			serviceEndpoints = append(serviceEndpoints, network.ServiceEndpointPropertiesFormat{
+				Service: to.StringPtr(service),
+			})
+		}
+		properties.ServiceEndpoints = &serviceEndpoints
+	}
+
+	if spec.NetworkSecurityGroupID != "" {
+		properties.NetworkSecurityGroup = &network.SecurityGroup{ID: to.StringPtr(spec.NetworkSecurityGroupID)}
+	}
+	if spec.RouteTableID != "" {
+		properties.RouteTable = &network.RouteTable{ID: to.StringPtr(spec.RouteTableID)}
+	}
+
+	return network.Subnet{
+		Name:                   to.StringPtr(spec.Name),
+		SubnetPropertiesFormat: properties,
+	}
+}
+
+// cidrsOverlap returns true if the given networks share any address
+func cidrsOverlap(a, b *net.IPNet) bool {
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
+
+// cidrContains returns true if the outer network contains every address of the inner network
+func cidrContains(outer, inner *net.IPNet) bool {
+	outerOnes, outerBits := outer.Mask.Size()
+	innerOnes, innerBits := inner.Mask.Size()
+	return outerBits == innerBits && outerOnes <= innerOnes && outer.Contains(inner.IP)
+}
+
+// getVirtualNetwork returns the virtual network with the given name, or nil if it does not exist
+func getVirtualNetwork(ctx context.Context, tc *provide.TargetCredentials, groupName, name string) (*network.VirtualNetwork, error) {
+	vnetClient, err := NewVirtualNetworksClient(tc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create virtual network client; %s", err.Error())
+	}
+
+	vnet, err := vnetClient.Get(ctx, groupName, name, "")
+	if err != nil {
+		if isNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get virtual network %s; %s", name, err.Error())
+	}
+
+	return &vnet, nil
+}
+
+// virtualNetworkSubnet returns the subnet of the given virtual network with the given name, or nil if it does not exist
+func virtualNetworkSubnet(vnet *network.VirtualNetwork, name string) *network.Subnet {
+	if vnet == nil || vnet.VirtualNetworkPropertiesFormat == nil || vnet.Subnets == nil {
+		return nil
+	}
+
+	for _, subnet := range *vnet.Subnets {
+		if strings.EqualFold(to.String(subnet.Name), name) {
+			return &subnet
+		}
+	}
+	return nil
+}
+
+// virtualNetworkSubnetPrefixes returns the address prefixes of the subnets of the given virtual network by name
+func virtualNetworkSubnetPrefixes(vnet *network.VirtualNetwork) map[string]string {
+	prefixes := map[string]string{}
+	if vnet == nil || vnet.VirtualNetworkPropertiesFormat == nil || vnet.Subnets == nil {
+		return prefixes
+	}
+
+	for _, subnet := range *vnet.Subnets {
+		if subnet.SubnetPropertiesFormat != nil && subnet.AddressPrefix != nil {
+			prefixes[to.String(subnet.Name)] = *subnet.AddressPrefix
+		}
+	}
+	return prefixes
+}
+
+// withPreservedSubnets returns the spec with the subnets of the existing virtual network which are not named in
+// the spec appended, so they are validated against the address space and the subnets of the spec
+func (s *VirtualNetworkSpec) withPreservedSubnets(existing *network.VirtualNetwork) *VirtualNetworkSpec {
+	spec := &VirtualNetworkSpec{
+		AddressPrefixes: s.AddressPrefixes,
+		Subnets:         make([]SubnetSpec, 0, len(s.Subnets)),
+	}
+	spec.Subnets = append(spec.Subnets, s.Subnets...)
+
+	names := map[string]bool{}
+	for _, subnet := range s.Subnets {
+		names[strings.ToLower(subnet.Name)] = true
+	}
+	for name, prefix := range virtualNetworkSubnetPrefixes(existing) {
+		if !names[strings.ToLower(name)] {
+			spec.Subnets = append(spec.Subnets, SubnetSpec{Name: name, AddressPrefix: prefix})
+		}
+	}
+	return spec
+}
+
+// preserveSubnets appends the subnets of the existing virtual network which are not named in the given virtual
+// network, so upserting a virtual network does not remove subnets created using UpsertSubnet or elsewhere
+func preserveSubnets(vnet *network.VirtualNetwork, existing *network.VirtualNetwork) {
+	if existing == nil || existing.VirtualNetworkPropertiesFormat == nil || existing.Subnets == nil {
+		return
+	}
+	if vnet.VirtualNetworkPropertiesFormat == nil {
+		vnet.VirtualNetworkPropertiesFormat = &network.VirtualNetworkPropertiesFormat{}
+	}
+
+	subnets := make([]network.Subnet, 0)
+	names := map[string]bool{}
+	if vnet.Subnets != nil {
+		subnets = append(subnets, *vnet.Subnets...)
+		for _, subnet := range subnets {
+			names[strings.ToLower(to.String(subnet.Name))] = true
+		}
+	}
+
+	for _, subnet := range *existing.Subnets {
+		if !names[strings.ToLower(to.String(subnet.Name))] {
+			subnets = append(subnets, subnet)
+		}
+	}
+	vnet.Subnets = &subnets
+}
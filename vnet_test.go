@@ -0,0 +1,205 @@
+package azurewrapper
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-12-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+func TestVirtualNetworkSpecValidate(t *testing.T) {
+	valid := &VirtualNetworkSpec{
+		AddressPrefixes: []string{"172.20.0.0/16", "172.21.0.0/16"},
+		Subnets: []SubnetSpec{
+			{Name: "containers", AddressPrefix: "172.20.0.0/24", Delegations: []string{"Microsoft.ContainerInstance/containerGroups"}},
+			{Name: "nodes", AddressPrefix: "172.21.1.0/24"},
+		},
+	}
+	if err := valid.validate(); err != nil {
+		t.Errorf("expected valid spec; %s", err.Error())
+	}
+
+	invalid := []*VirtualNetworkSpec{
+		{},
+		{AddressPrefixes: []string{"172.20.0.0"}},
+		{AddressPrefixes: []string{"172.20.0.0/16", "172.20.128.0/17"}},
+		{AddressPrefixes: []string{"172.20.0.0/16"}, Subnets: []SubnetSpec{{AddressPrefix: "172.20.0.0/24"}}},
+		{AddressPrefixes: []string{"172.20.0.0/16"}, Subnets: []SubnetSpec{{Name: "nodes", AddressPrefix: "172.21.0.0/24"}}},
+		{AddressPrefixes: []string{"172.20.0.0/16"}, Subnets: []SubnetSpec{{Name: "wide", AddressPrefix: "172.20.0.0/15"}}},
+		{AddressPrefixes: []string{"172.20.0.0/16"}, Subnets: []SubnetSpec{{Name: "a", AddressPrefix: "172.20.0.0/24"}, {Name: "b", AddressPrefix: "172.20.0.128/25"}}},
+		{AddressPrefixes: []string{"172.20.0.0/16"}, Subnets: []SubnetSpec{{Name: "a", AddressPrefix: "172.20.0.0/24"}, {Name: "A", AddressPrefix: "172.20.1.0/24"}}},
+		{AddressPrefixes: []string{"172.20.0.0/16"}, Subnets: []SubnetSpec{{Name: "a", AddressPrefix: "172.20.0.0/24", Delegations: []string{"containers"}}}},
+	}
+	for _, spec := range invalid {
+		if err := spec.validate(); err == nil {
+			t.Errorf("expected invalid spec to be rejected: %+v", spec)
+		}
+	}
+
+	var nilSpec *VirtualNetworkSpec
+	if !nilSpec.requiresAllocation() {
+		t.Errorf("expected nil spec to require allocation")
+	}
+	if !(&VirtualNetworkSpec{AddressPrefixes: []string{"172.20.0.0/16"}, Subnets: []SubnetSpec{{Name: "a"}}}).requiresAllocation() {
+		t.Errorf("expected subnet without an address prefix to require allocation")
+	}
+	if (&VirtualNetworkSpec{AddressPrefixes: []string{"172.20.0.0/16"}, Subnets: []SubnetSpec{{Name: "a", AddressPrefix: "172.20.0.0/24"}}}).requiresAllocation() {
+		t.Errorf("expected complete spec not to require allocation")
+	}
+}
+
+func TestVirtualNetworkFromSpec(t *testing.T) {
+	vnet := virtualNetworkFromSpec("eastus", nil, &VirtualNetworkSpec{
+		AddressPrefixes: []string{"172.20.0.0/16"},
+		Subnets: []SubnetSpec{
+			{
+				Name:                   "containers",
+				AddressPrefix:          "172.20.0.0/24",
+				Delegations:            []string{"Microsoft.ContainerInstance/containerGroups"},
+				ServiceEndpoints:       []string{"Microsoft.Storage"},
+				NetworkSecurityGroupID: "/subscriptions/abc/resourceGroups/skynet/providers/Microsoft.Network/networkSecurityGroups/containers-nsg",
+				RouteTableID:           "/subscriptions/abc/resourceGroups/skynet/providers/Microsoft.Network/routeTables/containers-rt",
+			},
+		},
+	}, nil)
+
+	if (*vnet.AddressSpace.AddressPrefixes)[0] != "172.20.0.0/16" {
+		t.Errorf("expected address prefix from spec; got %v", *vnet.AddressSpace.AddressPrefixes)
+	}
+
+	subnet := (*vnet.Subnets)[0]
+	if to.String(subnet.Name) != "containers" || to.String(subnet.AddressPrefix) != "172.20.0.0/24" {
+		t.Errorf("expected named subnet from spec; got %s %s", to.String(subnet.Name), to.String(subnet.AddressPrefix))
+	}
+	delegation := (*subnet.Delegations)[0]
+	if to.String(delegation.ServiceName) != "Microsoft.ContainerInstance/containerGroups" || to.String(delegation.Name) != "Microsoft.ContainerInstance.containerGroups" {
+		t.Errorf("expected container instance delegation; got %s %s", to.String(delegation.Name), to.String(delegation.ServiceName))
+	}
+	if to.String((*subnet.ServiceEndpoints)[0].Service) != "Microsoft.Storage" {
+		t.Errorf("expected storage service endpoint")
+	}
+	if subnet.NetworkSecurityGroup == nil || subnet.RouteTable == nil {
+		t.Errorf("expected network security group and route table associations")
+	}
+}
+
+func existingTestVirtualNetwork() *network.VirtualNetwork {
+	return &network.VirtualNetwork{
+		VirtualNetworkPropertiesFormat: &network.VirtualNetworkPropertiesFormat{
+			AddressSpace: &network.AddressSpace{
+				AddressPrefixes: &[]string{"10.4.0.0/16"},
+			},
+			Subnets: &[]network.Subnet{
+				{Name: to.StringPtr("default"), SubnetPropertiesFormat: &network.SubnetPropertiesFormat{AddressPrefix: to.StringPtr("10.4.0.0/24")}},
+				{Name: to.StringPtr("containers"), SubnetPropertiesFormat: &network.SubnetPropertiesFormat{AddressPrefix: to.StringPtr("10.4.1.0/24")}},
+			},
+		},
+	}
+}
+
+func TestVirtualNetworkFromSpecRetainsSubnetProperties(t *testing.T) {
+	nsgID := "/subscriptions/abc/resourceGroups/skynet/providers/Microsoft.Network/networkSecurityGroups/containers-nsg"
+	routeTableID := "/subscriptions/abc/resourceGroups/skynet/providers/Microsoft.Network/routeTables/containers-rt"
+	existing := &network.VirtualNetwork{
+		VirtualNetworkPropertiesFormat: &network.VirtualNetworkPropertiesFormat{
+			Subnets: &[]network.Subnet{
+				subnetFromSpec(SubnetSpec{
+					Name:                   "containers",
+					AddressPrefix:          "172.20.0.0/24",
+					Delegations:            []string{"Microsoft.ContainerInstance/containerGroups"},
+					ServiceEndpoints:       []string{"Microsoft.Storage"},
+					NetworkSecurityGroupID: nsgID,
+					RouteTableID:           routeTableID,
+				}, nil),
+			},
+		},
+	}
+
+	vnet := virtualNetworkFromSpec("eastus", nil, &VirtualNetworkSpec{
+		AddressPrefixes: []string{"172.20.0.0/16"},
+		Subnets: []SubnetSpec{
+			{Name: "Containers", AddressPrefix: "172.20.1.0/24", ServiceEndpoints: []string{"Microsoft.KeyVault"}},
+		},
+	}, existing)
+
+	subnet := (*vnet.Subnets)[0]
+	if to.String(subnet.AddressPrefix) != "172.20.1.0/24" {
+		t.Errorf("expected address prefix from spec; got %s", to.String(subnet.AddressPrefix))
+	}
+	if subnet.NetworkSecurityGroup == nil || to.String(subnet.NetworkSecurityGroup.ID) != nsgID {
+		t.Errorf("expected existing network security group to be retained; got %v", subnet.NetworkSecurityGroup)
+	}
+	if subnet.RouteTable == nil || to.String(subnet.RouteTable.ID) != routeTableID {
+		t.Errorf("expected existing route table to be retained; got %v", subnet.RouteTable)
+	}
+	if subnet.Delegations == nil || len(*subnet.Delegations) != 1 {
+		t.Errorf("expected existing delegations to be retained; got %v", subnet.Delegations)
+	}
+	if subnet.ServiceEndpoints == nil || len(*subnet.ServiceEndpoints) != 1 || to.String((*subnet.ServiceEndpoints)[0].Service) != "Microsoft.KeyVault" {
+		t.Errorf("expected service endpoints from spec; got %v", subnet.ServiceEndpoints)
+	}
+	if (*existing.Subnets)[0].ServiceEndpoints == nil || to.String((*(*existing.Subnets)[0].ServiceEndpoints)[0].Service) != "Microsoft.Storage" {
+		t.Errorf("expected existing subnet not to be modified")
+	}
+}
+
+func TestVirtualNetworkFromSpecRetainsProperties(t *testing.T) {
+	existing := existingTestVirtualNetwork()
+	existing.DhcpOptions = &network.DhcpOptions{DNSServers: &[]string{"10.4.0.4"}}
+	existing.VirtualNetworkPeerings = &[]network.VirtualNetworkPeering{{Name: to.StringPtr("hub")}}
+	existing.EnableDdosProtection = to.BoolPtr(true)
+	existing.DdosProtectionPlan = &network.SubResource{ID: to.StringPtr("/subscriptions/abc/resourceGroups/skynet/providers/Microsoft.Network/ddosProtectionPlans/plan")}
+	existing.EnableVMProtection = to.BoolPtr(true)
+
+	vnet := virtualNetworkFromSpec("eastus", nil, &VirtualNetworkSpec{
+		AddressPrefixes: []string{"10.4.0.0/16", "10.5.0.0/16"},
+		Subnets:         []SubnetSpec{{Name: "default", AddressPrefix: "10.4.0.0/24"}},
+	}, existing)
+
+	if len(*vnet.AddressSpace.AddressPrefixes) != 2 || len(*vnet.Subnets) != 1 {
+		t.Errorf("expected address space and subnets from spec; got %v %v", *vnet.AddressSpace.AddressPrefixes, *vnet.Subnets)
+	}
+	if vnet.DhcpOptions == nil || (*vnet.DhcpOptions.DNSServers)[0] != "10.4.0.4" {
+		t.Errorf("expected existing DHCP options to be retained; got %v", vnet.DhcpOptions)
+	}
+	if vnet.VirtualNetworkPeerings == nil || len(*vnet.VirtualNetworkPeerings) != 1 {
+		t.Errorf("expected existing peerings to be retained; got %v", vnet.VirtualNetworkPeerings)
+	}
+	if !to.Bool(vnet.EnableDdosProtection) || vnet.DdosProtectionPlan == nil || !to.Bool(vnet.EnableVMProtection) {
+		t.Errorf("expected existing DDoS and VM protection settings to be retained")
+	}
+	if len(*existing.AddressSpace.AddressPrefixes) != 1 || len(*existing.Subnets) != 2 {
+		t.Errorf("expected existing virtual network not to be modified")
+	}
+}
+
+func TestPreserveSubnets(t *testing.T) {
+	existing := existingTestVirtualNetwork()
+	spec := &VirtualNetworkSpec{
+		AddressPrefixes: []string{"10.4.0.0/16"},
+		Subnets:         []SubnetSpec{{Name: "default", AddressPrefix: "10.4.0.0/24"}},
+	}
+
+	if err := spec.withPreservedSubnets(existing).validate(); err != nil {
+		t.Errorf("expected spec with preserved subnets to be valid; %s", err.Error())
+	}
+	overlapping := &VirtualNetworkSpec{
+		AddressPrefixes: []string{"10.4.0.0/16"},
+		Subnets:         []SubnetSpec{{Name: "nodes", AddressPrefix: "10.4.1.0/24"}},
+	}
+	if err := overlapping.withPreservedSubnets(existing).validate(); err == nil {
+		t.Errorf("expected subnet overlapping a preserved subnet to be rejected")
+	}
+
+	vnet := virtualNetworkFromSpec("eastus", nil, spec, nil)
+	preserveSubnets(&vnet, existing)
+	if len(*vnet.Subnets) != 2 || to.String((*vnet.Subnets)[1].Name) != "containers" {
+		t.Errorf("expected containers subnet to be preserved")
+	}
+
+	vnet = virtualNetworkFromSpec("eastus", nil, spec, nil)
+	preserveSubnets(&vnet, nil)
+	if len(*vnet.Subnets) != 1 {
+		t.Errorf("expected no subnets to be preserved without an existing virtual network")
+	}
+}